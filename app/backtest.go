@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gin-zabbix/configs"
+	"gin-zabbix/connector"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+type BacktestAlertParamBody struct {
+	// 检查周期，delay 为兼容旧版本保留的同义字段
+	Interval  string `json:"interval" binding:"omitempty,duration" example:"1m"`
+	Delay     string `json:"delay" binding:"omitempty,duration" example:"3m"`
+	Window    string `json:"window" binding:"omitempty,duration" example:"15m"`
+	Lag       string `json:"lag" binding:"omitempty,duration" example:"1m"`
+	Threshold string `json:"threshold" binding:"required" example:">=10"`
+	Days      int    `json:"days" binding:"omitempty,min=1,max=90" example:"7"`
+	// 查询 DSL，与 query_string 二选一
+	Query json.RawMessage `json:"query" swaggertype:"object"`
+	// 时间字段，为空时从索引映射中自动识别
+	TimestampField string `json:"timestamp_field" example:"@timestamp"`
+	// query_string 的语法，默认为 lucene
+	QueryLanguage string `json:"query_language" binding:"omitempty,oneof=lucene kql" example:"kql"`
+}
+
+type BacktestFiring struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration string    `json:"duration"`
+}
+
+type histogramBucket struct {
+	Key      int64 `json:"key"`
+	DocCount int64 `json:"doc_count"`
+}
+
+// maxBacktestBuckets Elasticsearch search.max_buckets 的默认值
+const maxBacktestBuckets = 65536
+
+// backtestStep 直方图的桶宽，取检查周期和统计窗口的最大公约数，每次检查的数量为若干个相邻桶之和
+func backtestStep(interval, window time.Duration) time.Duration {
+	a, b := interval/time.Second, window/time.Second
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a * time.Second
+}
+
+// BuildBacktestBody 在覆盖整个回测区间的查询体上按 step 做 date_histogram，
+// extended_bounds 取查询的时间范围，区间首尾没有日志时也返回数量为 0 的桶
+func BuildBacktestBody(posts, timestampField string, step time.Duration, flavor connector.Flavor) ([]byte, error) {
+	var body map[string]interface{}
+	err := json.Unmarshal([]byte(posts), &body)
+	if err != nil {
+		return nil, fmt.Errorf("解析查询体失败：%s", err.Error())
+	}
+	item := connector.Item{Posts: posts}
+	gte, lte := item.GetRange()
+	if gte == "" || lte == "" {
+		return nil, fmt.Errorf("查询体中缺少时间范围")
+	}
+	body["aggs"] = map[string]interface{}{
+		"histogram": map[string]interface{}{
+			"date_histogram": map[string]interface{}{
+				"field":                    timestampField,
+				flavor.HistogramInterval(): fmt.Sprintf("%ds", int64(step/time.Second)),
+				"min_doc_count":            0,
+				"extended_bounds": map[string]interface{}{
+					"min": gte,
+					"max": lte,
+				},
+			},
+		},
+	}
+	return json.Marshal(body)
+}
+
+// EvaluateBacktest 按触发器语义逐次检查计算告警状态，返回每次告警的起止时间。
+// 桶宽为 step，每 every 个桶检查一次，每次检查统计最近 width 个桶的数量
+func EvaluateBacktest(buckets []histogramBucket, threshold string, step time.Duration, every, width int) ([]BacktestFiring, error) {
+	var firings []BacktestFiring
+	var current *BacktestFiring
+	var values []float64
+	var count int64
+	for i, bucket := range buckets {
+		count += bucket.DocCount
+		if i >= width {
+			count -= buckets[i-width].DocCount
+		}
+		if i+1 < width || (i+1-width)%every != 0 {
+			continue
+		}
+		values = append(values, float64(count))
+		breached, err := EvaluateTrigger(threshold, values)
+		if err != nil {
+			return nil, err
+		}
+		at := time.UnixMilli(bucket.Key).Add(step)
+		if breached && current == nil {
+			current = &BacktestFiring{Start: at}
+		}
+		if !breached && current != nil {
+			current.End = at
+			current.Duration = current.End.Sub(current.Start).String()
+			firings = append(firings, *current)
+			current = nil
+		}
+	}
+	// 回测结束时仍处于告警状态
+	if current != nil && len(buckets) > 0 {
+		current.End = time.UnixMilli(buckets[len(buckets)-1].Key).Add(step)
+		current.Duration = current.End.Sub(current.Start).String()
+		firings = append(firings, *current)
+	}
+	return firings, nil
+}
+
+// BacktestAlert
+// @Summary Backtest Alert
+// @Schemes http
+// @Description 用历史日志回测告警规则，返回过去 N 天内告警触发的次数、时间和总时长
+// @Tags alert
+// @Accept json
+// @Produce json
+// @Param name query string true "名称"
+// @Param index query string true "索引"
+// @Param query_string query string false "查询字符串，与请求体中的 query 二选一"
+// @Param cluster query string false "Elasticsearch 集群名称，默认为 default"
+// @Param request body BacktestAlertParamBody true "回测配置"
+// @Success 200 {string} Success
+// @Security BasicAuth
+// @Router /v1/alert/backtest [post]
+func BacktestAlert(c *gin.Context) {
+	var body BacktestAlertParamBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	var query CreatAlertParamQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	config := c.MustGet("config").(configs.Config)
+
+	interval := body.Interval
+	if interval == "" {
+		interval = body.Delay
+	}
+	window := body.Window
+	if window == "" {
+		window = interval
+	}
+	if interval == "" {
+		interval = window
+	}
+	intervalDuration, err := connector.ParseDuration(interval)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	windowDuration, err := connector.ParseDuration(window)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	days := body.Days
+	if days == 0 {
+		days = 7
+	}
+	// 按检查周期计数，桶数超过 search.max_buckets 时查询会失败，查询前拒绝
+	step := backtestStep(intervalDuration, windowDuration)
+	buckets := int64(time.Duration(days)*24*time.Hour/step) + 1
+	if buckets > maxBacktestBuckets {
+		maxDays := int64(maxBacktestBuckets-1) * int64(step) / int64(24*time.Hour)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error": fmt.Sprintf("回测需要 %d 个直方图桶，超过 search.max_buckets 默认值 %d，检查周期 %s、统计窗口 %s 时最多回测 %d 天",
+				buckets, maxBacktestBuckets, interval, window, maxDays),
+			"data": map[string]interface{}{},
+		})
+		return
+	}
+
+	cluster, err := config.GetCluster(query.Cluster)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	if cluster.Backend == connector.BackendLoki {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  "回测暂不支持 Loki",
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	es := connector.NewElasticsearch(cluster)
+	timestampField, err := es.ResolveTimestampField(query.Index, body.TimestampField, cluster.TimestampField)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	queryString, dsl, err := TranslateQuery(body.QueryLanguage, query.QueryString, body.Query)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	// 查询范围扩大到过去 days 天
+	posts, err := connector.BuildPosts(queryString, dsl, connector.PostsOptions{
+		TimestampField: timestampField,
+		Window:         fmt.Sprintf("%dd", days),
+		Lag:            body.Lag,
+		Flavor:         es.Flavor(),
+	})
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	searchBody, err := BuildBacktestBody(posts, timestampField, step, es.Flavor())
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	result, err := es.Search(query.Index, searchBody)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	var histogram struct {
+		Buckets []histogramBucket `json:"buckets"`
+	}
+	err = json.Unmarshal(result.Aggregations["histogram"], &histogram)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  fmt.Sprintf("解析聚合结果失败：%s", err.Error()),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	firings, err := EvaluateBacktest(histogram.Buckets, body.Threshold, step,
+		int(intervalDuration/step), int(windowDuration/step))
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	var total time.Duration
+	for _, firing := range firings {
+		total += firing.End.Sub(firing.Start)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"error":  "",
+		"data": map[string]interface{}{
+			"name":           query.Name,
+			"days":           days,
+			"interval":       interval,
+			"window":         window,
+			"buckets":        len(histogram.Buckets),
+			"fired":          len(firings),
+			"total_duration": total.String(),
+			"firings":        firings,
+		},
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"gin-zabbix/connector"
+	"testing"
+	"time"
+)
+
+func TestBuildBacktestBodyExtendedBounds(t *testing.T) {
+	posts, err := connector.GeneratePosts("level:error", connector.PostsOptions{
+		TimestampField: "@timestamp",
+		Window:         "7d",
+		Lag:            "1m",
+		Flavor:         connector.Elasticsearch7,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := BuildBacktestBody(posts, "@timestamp", time.Minute, connector.Elasticsearch7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Aggs struct {
+			Histogram struct {
+				DateHistogram struct {
+					FixedInterval  string `json:"fixed_interval"`
+					MinDocCount    int    `json:"min_doc_count"`
+					ExtendedBounds struct {
+						Min string `json:"min"`
+						Max string `json:"max"`
+					} `json:"extended_bounds"`
+				} `json:"date_histogram"`
+			} `json:"histogram"`
+		} `json:"aggs"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatal(err)
+	}
+	histogram := body.Aggs.Histogram.DateHistogram
+	if histogram.FixedInterval != "60s" || histogram.MinDocCount != 0 {
+		t.Errorf("date_histogram = %+v, want fixed_interval 60s and min_doc_count 0", histogram)
+	}
+	if histogram.ExtendedBounds.Min != "now-1m-7d" || histogram.ExtendedBounds.Max != "now-1m" {
+		t.Errorf("extended_bounds = %+v, want now-1m-7d to now-1m", histogram.ExtendedBounds)
+	}
+}
+
+func TestEvaluateBacktestEmptyEdgeBuckets(t *testing.T) {
+	// 区间首尾没有日志，extended_bounds 补齐的桶数量为 0
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	counts := []int64{0, 0, 0, 5, 5, 5, 5, 0, 0, 0, 0}
+	var buckets []histogramBucket
+	for i, count := range counts {
+		key := start.Add(time.Duration(i) * time.Minute).UnixMilli()
+		buckets = append(buckets, histogramBucket{Key: key, DocCount: count})
+	}
+	firings, err := EvaluateBacktest(buckets, "<1", time.Minute, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ start, end int }{{3, 6}, {10, 11}}
+	if len(firings) != len(want) {
+		t.Fatalf("got %d firings %+v, want %d", len(firings), firings, len(want))
+	}
+	for i, w := range want {
+		wantStart := start.Add(time.Duration(w.start) * time.Minute)
+		wantEnd := start.Add(time.Duration(w.end) * time.Minute)
+		if !firings[i].Start.Equal(wantStart) || !firings[i].End.Equal(wantEnd) {
+			t.Errorf("firing %d = %s ~ %s, want %s ~ %s", i, firings[i].Start, firings[i].End, wantStart, wantEnd)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"fmt"
+	"gin-zabbix/configs"
+	"gin-zabbix/connector"
+	"gin-zabbix/store"
+	"github.com/gin-gonic/gin"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 动态基线：根据监控项的小时趋势数据，按“一周中的第几个小时”分别计算分位数阈值，
+// 写入触发器引用的主机宏 {$LOG_BASELINE:"<key>"}，并在本地保存计算历史。
+
+const (
+	baselinePercentileTag = "baseline_percentile"
+	baselineMarginTag     = "baseline_margin"
+	baselineStoreName     = "baseline"
+)
+
+type BaselineParam struct {
+	Percentile float64 `json:"percentile" binding:"omitempty,gt=0,lte=100" example:"95"`
+	Margin     float64 `json:"margin" example:"20"`
+}
+
+type BaselineRecord struct {
+	Time       time.Time `json:"time"`
+	HourOfWeek int       `json:"hour_of_week"`
+	Threshold  string    `json:"threshold"`
+	Samples    int       `json:"samples"`
+}
+
+// macroContextEscaper 宏上下文在双引号内，需要转义反斜杠和双引号
+var macroContextEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// BaselineMacro 基线阈值所在的主机宏，以监控项 key 作为上下文区分
+func BaselineMacro(key string) string {
+	return fmt.Sprintf(`{$LOG_BASELINE:"%s"}`, macroContextEscaper.Replace(key))
+}
+
+// SplitThreshold 将 ">=10" 拆分为运算符 ">=" 和数值 "10"
+func SplitThreshold(threshold string) (string, string) {
+	threshold = strings.TrimSpace(threshold)
+	for _, op := range []string{">=", "<=", "<>", ">", "<", "="} {
+		if strings.HasPrefix(threshold, op) {
+			return op, strings.TrimSpace(threshold[len(op):])
+		}
+	}
+	return "", threshold
+}
+
+func hourOfWeek(t time.Time) int {
+	return int(t.Weekday())*24 + t.Hour()
+}
+
+// percentile 线性插值计算分位数，p 取值 0~100，超出范围时按边界处理
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	if math.IsNaN(p) || p < 0 {
+		p = 0
+	} else if p > 100 {
+		p = 100
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// computeBaseline 取与 at 处于同一“周内小时”的历史小时最大值，计算分位数并加上百分比余量
+func computeBaseline(trends []connector.Trend, p, margin float64, at time.Time) (float64, int) {
+	slot := hourOfWeek(at)
+	var values []float64
+	for _, trend := range trends {
+		clock, err := strconv.ParseInt(trend.Clock, 10, 64)
+		if err != nil {
+			continue
+		}
+		if hourOfWeek(time.Unix(clock, 0)) != slot {
+			continue
+		}
+		value, err := strconv.ParseFloat(trend.ValueMax, 64)
+		if err != nil {
+			continue
+		}
+		values = append(values, value)
+	}
+	if len(values) == 0 {
+		return 0, 0
+	}
+	return math.Ceil(percentile(values, p) * (1 + margin/100)), len(values)
+}
+
+// SetBaselineMacro 宏存在则更新，不存在则创建
+func SetBaselineMacro(zabbix *connector.Zabbix, hostID, key, value string) error {
+	macro, err := zabbix.GetUserMacro(hostID, BaselineMacro(key))
+	if err != nil {
+		return err
+	}
+	if macro.HostMacroID == "" {
+		_, err = zabbix.CreateUserMacro(hostID, BaselineMacro(key), value)
+		return err
+	}
+	_, err = zabbix.UpdateUserMacro(macro.HostMacroID, value)
+	return err
+}
+
+func updateBaseline(config configs.Config, zabbix *connector.Zabbix, item connector.Item, now time.Time) (BaselineRecord, error) {
+	// 标签可能被手工修改，解析失败或超出范围时使用配置的分位数
+	p, err := strconv.ParseFloat(item.GetTag(baselinePercentileTag), 64)
+	if err != nil || !(p > 0 && p <= 100) {
+		p = config.Baseline.Percentile
+	}
+	margin, err := strconv.ParseFloat(item.GetTag(baselineMarginTag), 64)
+	if err != nil {
+		margin = config.Baseline.Margin
+	}
+
+	timeFrom := now.AddDate(0, 0, -7*config.Baseline.LookbackWeeks).Unix()
+	trends, err := zabbix.GetTrends(item.ItemID, timeFrom, now.Unix())
+	if err != nil {
+		return BaselineRecord{}, err
+	}
+
+	threshold, samples := computeBaseline(trends, p, margin, now)
+	record := BaselineRecord{
+		Time:       now,
+		HourOfWeek: hourOfWeek(now),
+		Samples:    samples,
+	}
+	// 没有历史数据时保留宏的当前值
+	if samples == 0 {
+		return record, nil
+	}
+	record.Threshold = strconv.FormatFloat(threshold, 'f', -1, 64)
+
+	err = SetBaselineMacro(zabbix, item.HostID, item.Key, record.Threshold)
+	if err != nil {
+		return BaselineRecord{}, err
+	}
+	return record, nil
+}
+
+func refreshBaselines(config configs.Config, st *store.Store) {
+	zabbix := connector.NewZabbix(config.Zabbix.Url, config.Zabbix.Token)
+	items, err := zabbix.GetItemsByTag(baselinePercentileTag)
+	if err != nil {
+		log.Printf("获取基线监控项失败：%s", err.Error())
+		return
+	}
+
+	now := time.Now()
+	records := map[string]BaselineRecord{}
+	for _, item := range items {
+		record, err := updateBaseline(config, zabbix, item, now)
+		if err != nil {
+			log.Printf("计算基线失败 %s：%s", item.Name, err.Error())
+			continue
+		}
+		records[item.ItemID] = record
+	}
+
+	// 历史按监控项 ID 保存，不同主机上相同键的监控项互不影响；已不存在的监控项的历史一并删除
+	history := map[string][]BaselineRecord{}
+	err = st.Update(baselineStoreName, &history, func() error {
+		current := map[string]bool{}
+		for _, item := range items {
+			current[item.ItemID] = true
+		}
+		for itemID := range history {
+			if !current[itemID] {
+				delete(history, itemID)
+			}
+		}
+		for itemID, record := range records {
+			itemRecords := append(history[itemID], record)
+			if len(itemRecords) > config.Baseline.HistorySize {
+				itemRecords = itemRecords[len(itemRecords)-config.Baseline.HistorySize:]
+			}
+			history[itemID] = itemRecords
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("保存基线历史失败：%s", err.Error())
+	}
+}
+
+// DeleteBaselineHistory 删除监控项的基线历史，不存在时不做任何操作
+func DeleteBaselineHistory(st *store.Store, itemID string) error {
+	history := map[string][]BaselineRecord{}
+	return st.Update(baselineStoreName, &history, func() error {
+		delete(history, itemID)
+		return nil
+	})
+}
+
+// RunBaseline 按配置的周期重新计算所有基线告警的阈值
+func RunBaseline(config configs.Config, st *store.Store) {
+	interval, err := time.ParseDuration(config.Baseline.Interval)
+	if err != nil {
+		log.Printf("基线计算周期配置错误：%s", err.Error())
+		return
+	}
+	refreshBaselines(config, st)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		refreshBaselines(config, st)
+	}
+}
+
+type QueryBaselineParamQuery struct {
+	Name    string `form:"name" binding:"required"`
+	Index   string `form:"index" binding:"required"`
+	Cluster string `form:"cluster"`
+}
+
+// QueryBaseline
+// @Summary Query Baseline
+// @Schemes http
+// @Description 查询动态基线告警当前阈值及计算历史
+// @Tags alert
+// @Accept json
+// @Produce json
+// @Param name query string true "名称"
+// @Param index query string true "索引"
+// @Param cluster query string false "Elasticsearch 集群名称，默认为 default"
+// @Success 200 {string} Success
+// @Security BasicAuth
+// @Router /v1/alert/baseline [get]
+func QueryBaseline(c *gin.Context) {
+	var query QueryBaselineParamQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	config := c.MustGet("config").(configs.Config)
+	st := c.MustGet("store").(*store.Store)
+	zabbix := connector.NewZabbix(config.Zabbix.Url, config.Zabbix.Token)
+
+	// 已索引名称命名主机
+	host, err := GetIndexHost(zabbix, query.Cluster, query.Index)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	if host.HostID == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": "failure",
+			"error":  "索引同名主机不存在",
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	item, err := zabbix.GetItemByName(query.Name, host.HostID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	if item.GetTag(baselinePercentileTag) == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": "failure",
+			"error":  "该告警未启用动态基线",
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	macro, err := zabbix.GetUserMacro(host.HostID, BaselineMacro(item.Key))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	history := map[string][]BaselineRecord{}
+	err = st.Load(baselineStoreName, &history)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"error":  "",
+		"data": map[string]interface{}{
+			"name":       item.Name,
+			"macro":      BaselineMacro(item.Key),
+			"threshold":  macro.Value,
+			"percentile": item.GetTag(baselinePercentileTag),
+			"margin":     item.GetTag(baselineMarginTag),
+			"history":    history[item.ItemID],
+		},
+	})
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"gin-zabbix/configs"
+	"gin-zabbix/connector"
+	"gin-zabbix/store"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// 组合告警：引用多个已有的日志告警，用 and/or 拼接成一个多监控项的触发器表达式
+
+type CompositeMember struct {
+	Name  string `json:"name" binding:"required" example:"payment errors"`
+	Index string `json:"index" binding:"required" example:"payment-*"`
+	// Elasticsearch 集群名称，默认为 default
+	Cluster string `json:"cluster" example:"default"`
+	// 为空时沿用被引用告警自身触发器的阈值
+	Threshold string `json:"threshold" example:">=10"`
+}
+
+type CompositeAlert struct {
+	Name        string            `json:"name"`
+	TriggerID   string            `json:"trigger_id"`
+	Expression  string            `json:"expression"`
+	Description string            `json:"description"`
+	Members     []CompositeMember `json:"members"`
+}
+
+type CreatCompositeAlertParamBody struct {
+	Name        string            `json:"name" binding:"required" example:"payment degraded"`
+	Operator    string            `json:"operator" binding:"required,oneof=and or" example:"and"`
+	Description string            `json:"description" example:"description"`
+	Alerts      []CompositeMember `json:"alerts" binding:"required,min=2,dive"`
+}
+
+// BuildCompositeExpression 拼接组合触发器表达式，每个成员沿用 CreateTrigger 的 last(...,#3) 判断
+func BuildCompositeExpression(operator string, hostNames, keys, thresholds []string) (string, error) {
+	parts := make([]string, len(keys))
+	for i := range keys {
+		part, err := connector.TriggerExpression(hostNames[i], keys[i], thresholds[i])
+		if err != nil {
+			return "", err
+		}
+		parts[i] = part
+	}
+	return strings.Join(parts, fmt.Sprintf(" %s ", operator)), nil
+}
+
+// toCompositeAlert 从触发器引用的监控项还原组合告警的成员
+func toCompositeAlert(trigger connector.Trigger) CompositeAlert {
+	members := make([]CompositeMember, 0, len(trigger.Items))
+	for i := range trigger.Items {
+		members = append(members, CompositeMember{
+			Name:  trigger.Items[i].Name,
+			Index: trigger.Items[i].GetIndex(),
+		})
+	}
+	return CompositeAlert{
+		Name:        trigger.Description,
+		TriggerID:   trigger.TriggerID,
+		Expression:  trigger.Expression,
+		Description: trigger.Comments,
+		Members:     members,
+	}
+}
+
+// CreatCompositeAlert
+// @Summary Creat Composite Alert
+// @Schemes http
+// @Description 创建组合告警规则，引用已有告警并以 and/or 组合
+// @Tags composite
+// @Accept json
+// @Produce json
+// @Param request body CreatCompositeAlertParamBody true "组合配置"
+// @Success 200 {string} Success
+// @Security BasicAuth
+// @Router /v1/composite/creat [post]
+func CreatCompositeAlert(c *gin.Context) {
+	var body CreatCompositeAlertParamBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	config := c.MustGet("config").(configs.Config)
+	zabbix := connector.NewZabbix(config.Zabbix.Url, config.Zabbix.Token)
+
+	var hostNames, keys, thresholds []string
+	for _, member := range body.Alerts {
+		// 已索引名称命名主机
+		host, err := GetIndexHost(zabbix, member.Cluster, member.Index)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status": "failure",
+				"error":  err.Error(),
+				"data":   map[string]interface{}{},
+			})
+			return
+		}
+		if host.HostID == "" {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status": "failure",
+				"error":  fmt.Sprintf("索引同名主机不存在：%s", member.Index),
+				"data":   map[string]interface{}{},
+			})
+			return
+		}
+
+		item, err := zabbix.GetItemByName(member.Name, host.HostID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status": "failure",
+				"error":  err.Error(),
+				"data":   map[string]interface{}{},
+			})
+			return
+		}
+
+		threshold := member.Threshold
+		if threshold == "" {
+			trigger, err := zabbix.GetAlertTrigger(item.ItemID)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{
+					"status": "failure",
+					"error":  err.Error(),
+					"data":   map[string]interface{}{},
+				})
+				return
+			}
+			threshold = trigger.GetThreshold()
+		}
+		hostNames = append(hostNames, host.Host)
+		keys = append(keys, item.Key)
+		thresholds = append(thresholds, threshold)
+	}
+
+	expression, err := BuildCompositeExpression(body.Operator, hostNames, keys, thresholds)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	triggerID, err := zabbix.CreateCompositeTrigger(body.Name, expression, body.Description)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"error":  "",
+		"data": map[string]interface{}{
+			"TriggerID":  triggerID,
+			"expression": expression,
+		},
+	})
+}
+
+// QueryCompositeAlert
+// @Summary Query Composite Alerts
+// @Schemes http
+// @Description 查询全部组合告警及其引用的告警
+// @Tags composite
+// @Accept json
+// @Produce json
+// @Success 200 {string} Success
+// @Security BasicAuth
+// @Router /v1/composite/query [get]
+func QueryCompositeAlert(c *gin.Context) {
+	config := c.MustGet("config").(configs.Config)
+	zabbix := connector.NewZabbix(config.Zabbix.Url, config.Zabbix.Token)
+
+	triggers, err := zabbix.GetCompositeTriggers(nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	trapperItems, err := LoadTrapperItems(c.MustGet("store").(*store.Store))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	composites := make([]CompositeAlert, 0, len(triggers))
+	for i := range triggers {
+		for j := range triggers[i].Items {
+			FillTrapperItem(&triggers[i].Items[j], trapperItems)
+		}
+		composites = append(composites, toCompositeAlert(triggers[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"error":  "",
+		"data":   composites,
+	})
+}
+
+type DeleteCompositeAlertParamQuery struct {
+	Name string `form:"name" binding:"required"`
+}
+
+// DeleteCompositeAlert
+// @Summary Delete Composite Alert
+// @Schemes http
+// @Description 删除组合告警规则，不影响被引用的告警
+// @Tags composite
+// @Accept json
+// @Produce json
+// @Param name query string true "名称"
+// @Success 204 {string} Success
+// @Security BasicAuth
+// @Router /v1/composite/delete [delete]
+func DeleteCompositeAlert(c *gin.Context) {
+	var query DeleteCompositeAlertParamQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	config := c.MustGet("config").(configs.Config)
+	zabbix := connector.NewZabbix(config.Zabbix.Url, config.Zabbix.Token)
+
+	triggers, err := zabbix.GetCompositeTriggers(nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	triggerID := ""
+	for i := range triggers {
+		if triggers[i].Description == query.Name {
+			triggerID = triggers[i].TriggerID
+			break
+		}
+	}
+	if triggerID == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": "failure",
+			"error":  fmt.Sprintf("组合告警不存在：%s", query.Name),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	_, err = zabbix.DeleteTriggerByID(triggerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{
+		"status": "success",
+		"error":  "",
+		"data": map[string]interface{}{
+			"name": query.Name,
+		},
+	})
+}
@@ -1,7 +1,9 @@
 package configs
 
 import (
+	"fmt"
 	"gopkg.in/yaml.v3"
+	"net/url"
 	"os"
 )
 
@@ -10,6 +12,13 @@ type Config struct {
 	BasicAuth     BasicAuthConfig     `yaml:"basic"`
 	Zabbix        ZabbixConfig        `yaml:"zabbix"`
 	Elasticsearch ElasticsearchConfig `yaml:"elasticsearch"`
+	// 其他命名的 Elasticsearch 集群，elasticsearch 配置即名为 default 的集群
+	Clusters   map[string]ElasticsearchConfig `yaml:"clusters"`
+	Storage    StorageConfig                  `yaml:"storage"`
+	Baseline   BaselineConfig                 `yaml:"baseline"`
+	Lint       LintConfig                     `yaml:"lint"`
+	Enrichment EnrichmentConfig               `yaml:"enrichment"`
+	Alerting   AlertingConfig                 `yaml:"alerting"`
 }
 
 type ServerConfig struct {
@@ -25,12 +34,125 @@ type BasicAuthConfig struct {
 type ZabbixConfig struct {
 	Url   string `yaml:"url"`
 	Token string `yaml:"token"`
+	// 监控项类型：http_agent（默认）由 Zabbix server 直接请求日志后端，
+	// trapper 由本服务执行查询后通过 sender 协议推送
+	Mode    string        `yaml:"mode"`
+	Trapper TrapperConfig `yaml:"trapper"`
+}
+
+// TrapperConfig trapper 模式下推送命中数的目标和批量参数
+type TrapperConfig struct {
+	// Zabbix server 或 proxy 的 trapper 地址
+	Address string `yaml:"address"`
+	// 每个请求最多包含的值数量
+	BatchSize int `yaml:"batch_size"`
+	// 检查到期监控项的周期，各监控项仍按自己的检查周期执行
+	Interval string `yaml:"interval"`
 }
 
 type ElasticsearchConfig struct {
+	// 日志后端：elasticsearch（默认）或 loki，Loki 集群只使用 url、认证、tenant_id 和 TLS 设置
+	Backend  string `yaml:"backend"`
 	Url      string `yaml:"url"`
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
+	// Loki 多租户模式下的租户 ID，作为 X-Scope-OrgID 请求头发送
+	TenantID string `yaml:"tenant_id"`
+	// 后端类型：elasticsearch6、elasticsearch7（默认）、elasticsearch8、opensearch1、opensearch2
+	Flavor string `yaml:"flavor"`
+	// 默认时间字段，创建告警时未指定且无法从映射中识别时使用
+	TimestampField string `yaml:"timestamp_field"`
+	// API key（即创建 API key 时返回的 encoded 值），配置后优先于用户名密码
+	ApiKey string `yaml:"api_key"`
+	// 本服务校验 Elasticsearch 证书使用的 CA 文件或 CA 证书 SHA-256 指纹，都未配置时不校验证书
+	CaFile        string `yaml:"ca_file"`
+	CaFingerprint string `yaml:"ca_fingerprint"`
+	// 写入 Zabbix HTTP agent 监控项的 TLS 设置，CA 由 Zabbix server 的 SSLCALocation 指定
+	VerifyPeer  bool   `yaml:"verify_peer"`
+	VerifyHost  bool   `yaml:"verify_host"`
+	SslCertFile string `yaml:"ssl_cert_file"`
+	SslKeyFile  string `yaml:"ssl_key_file"`
+	// Kibana 地址，使用空间时包含空间前缀，配置后告警返回 Discover 链接
+	KibanaUrl string `yaml:"kibana_url"`
+	// 索引模式到 Kibana 数据视图 ID 的映射，未配置的索引模式使用其本身作为 ID
+	KibanaDataViews map[string]string `yaml:"kibana_data_views"`
+}
+
+// StorageConfig 本地数据目录，保存服务自身产生的状态
+type StorageConfig struct {
+	Path string `yaml:"path"`
+}
+
+// BaselineConfig 动态基线阈值的计算参数
+type BaselineConfig struct {
+	Interval      string  `yaml:"interval"`
+	LookbackWeeks int     `yaml:"lookback_weeks"`
+	Percentile    float64 `yaml:"percentile"`
+	Margin        float64 `yaml:"margin"`
+	HistorySize   int     `yaml:"history_size"`
+}
+
+// LintConfig 创建告警时的查询检查策略
+type LintConfig struct {
+	// warn 只返回警告，deny 拒绝创建，off 不检查
+	Policy string `yaml:"policy"`
+	// 统计窗口上限和检查周期下限
+	MaxWindow   string `yaml:"max_window"`
+	MinInterval string `yaml:"min_interval"`
+}
+
+// EnrichmentConfig 告警触发时附加的上下文：按字段统计命中最多的值，并附上示例日志
+type EnrichmentConfig struct {
+	// 是否周期检查新问题并写入确认消息，关闭时仍可通过接口查询
+	Enabled      bool     `yaml:"enabled"`
+	Interval     string   `yaml:"interval"`
+	Fields       []string `yaml:"fields"`
+	TopSize      int      `yaml:"top_size"`
+	Samples      int      `yaml:"samples"`
+	MessageField string   `yaml:"message_field"`
+}
+
+// AlertingConfig 告警的执行方式
+type AlertingConfig struct {
+	// zabbix（默认）创建 Zabbix 监控项和触发器，internal 由本服务周期执行查询并判断阈值，不需要 Zabbix
+	Backend string `yaml:"backend"`
+	// 内置引擎检查到期告警的周期，各告警仍按自己的检查周期执行
+	Interval string `yaml:"interval"`
+}
+
+// DefaultCluster elasticsearch 配置对应的集群名称
+const DefaultCluster = "default"
+
+// GetCluster 返回指定名称的集群配置，名称为空或 default 时返回 elasticsearch 配置
+func (c Config) GetCluster(name string) (ElasticsearchConfig, error) {
+	if name == "" || name == DefaultCluster {
+		return c.Elasticsearch, nil
+	}
+	cluster, ok := c.Clusters[name]
+	if !ok {
+		return ElasticsearchConfig{}, fmt.Errorf("Elasticsearch 集群不存在：%s", name)
+	}
+	return cluster, nil
+}
+
+// ClusterName 根据地址反查集群名称，只比较协议、主机和端口，找不到时返回空字符串
+func (c Config) ClusterName(address string) string {
+	origin := func(address string) string {
+		u, err := url.Parse(address)
+		if err != nil {
+			return address
+		}
+		return fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+	}
+	if origin(c.Elasticsearch.Url) == origin(address) {
+		return DefaultCluster
+	}
+	for name, cluster := range c.Clusters {
+		if origin(cluster.Url) == origin(address) {
+			return name
+		}
+	}
+	return ""
 }
 
 func LoadConfig(file string) (Config, error) {
@@ -46,5 +168,90 @@ func LoadConfig(file string) (Config, error) {
 		return config, err
 	}
 
+	config.setDefaults()
+	if err = config.validate(); err != nil {
+		return config, err
+	}
+
 	return config, nil
 }
+
+// validate 检查设置默认值后仍然无效的配置
+func (c *Config) validate() error {
+	if !(c.Baseline.Percentile > 0 && c.Baseline.Percentile <= 100) {
+		return fmt.Errorf("baseline.percentile 必须在 (0, 100] 范围内: %v", c.Baseline.Percentile)
+	}
+	if c.Zabbix.Trapper.BatchSize < 0 {
+		return fmt.Errorf("zabbix.trapper.batch_size 必须大于 0: %d", c.Zabbix.Trapper.BatchSize)
+	}
+	return nil
+}
+
+func (c *Config) setDefaults() {
+	if c.Elasticsearch.TimestampField == "" {
+		c.Elasticsearch.TimestampField = "@timestamp"
+	}
+	for name, cluster := range c.Clusters {
+		if cluster.TimestampField == "" {
+			cluster.TimestampField = c.Elasticsearch.TimestampField
+			c.Clusters[name] = cluster
+		}
+	}
+	if c.Storage.Path == "" {
+		c.Storage.Path = "data"
+	}
+	if c.Baseline.Interval == "" {
+		c.Baseline.Interval = "1h"
+	}
+	if c.Baseline.LookbackWeeks == 0 {
+		c.Baseline.LookbackWeeks = 4
+	}
+	if c.Baseline.Percentile == 0 {
+		c.Baseline.Percentile = 95
+	}
+	if c.Baseline.HistorySize == 0 {
+		c.Baseline.HistorySize = 168
+	}
+	if c.Lint.Policy == "" {
+		c.Lint.Policy = "warn"
+	}
+	if c.Lint.MaxWindow == "" {
+		c.Lint.MaxWindow = "1d"
+	}
+	if c.Lint.MinInterval == "" {
+		c.Lint.MinInterval = "30s"
+	}
+	if c.Enrichment.Interval == "" {
+		c.Enrichment.Interval = "1m"
+	}
+	if len(c.Enrichment.Fields) == 0 {
+		c.Enrichment.Fields = []string{"host.name", "service.name", "error.type"}
+	}
+	if c.Enrichment.TopSize == 0 {
+		c.Enrichment.TopSize = 5
+	}
+	if c.Enrichment.Samples == 0 {
+		c.Enrichment.Samples = 3
+	}
+	if c.Enrichment.MessageField == "" {
+		c.Enrichment.MessageField = "message"
+	}
+	if c.Zabbix.Mode == "" {
+		c.Zabbix.Mode = "http_agent"
+	}
+	if c.Zabbix.Trapper.Address == "" {
+		c.Zabbix.Trapper.Address = "127.0.0.1:10051"
+	}
+	if c.Zabbix.Trapper.BatchSize == 0 {
+		c.Zabbix.Trapper.BatchSize = 250
+	}
+	if c.Zabbix.Trapper.Interval == "" {
+		c.Zabbix.Trapper.Interval = "10s"
+	}
+	if c.Alerting.Backend == "" {
+		c.Alerting.Backend = "zabbix"
+	}
+	if c.Alerting.Interval == "" {
+		c.Alerting.Interval = "10s"
+	}
+}
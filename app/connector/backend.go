@@ -0,0 +1,202 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"gin-zabbix/configs"
+	"strings"
+)
+
+// 日志后端：告警监控项统计哪里的日志、如何从响应中取出命中数，由集群配置的 backend 决定
+
+const (
+	BackendElasticsearch = "elasticsearch"
+	BackendLoki          = "loki"
+	// BackendTag 监控项上记录后端类型的标签，没有该标签的监控项为 Elasticsearch
+	BackendTag = "backend"
+)
+
+// LogQuery 告警的查询条件和统计区间 [now-lag-window, now-lag]
+type LogQuery struct {
+	QueryString string
+	// 查询 DSL，只有 Elasticsearch 支持
+	Query          json.RawMessage
+	TimestampField string
+	Window         string
+	Lag            string
+}
+
+// LogRequest Zabbix HTTP agent 监控项的请求，以及从响应中取出命中数的预处理步骤
+type LogRequest struct {
+	Url string
+	// 请求体，为空时不发送
+	Posts string
+	// URL 查询参数，对应监控项的 query_fields
+	QueryFields []map[string]string
+	// 对应监控项的 preprocessing
+	Preprocessing []map[string]string
+	// 时间字段，预览时按其倒序返回日志
+	TimestampField string
+}
+
+type PreviewOptions struct {
+	Size   int
+	Fields []string
+}
+
+type LogBackend interface {
+	// Name 后端类型，写入监控项的 backend 标签
+	Name() string
+	Ping() error
+	// BuildRequest 生成统计命中数的监控项请求
+	BuildRequest(index string, query LogQuery) (LogRequest, error)
+	// Validate 写入 Zabbix 之前校验索引和查询
+	Validate(index string, request LogRequest) error
+	// Preview 立即执行一次请求，返回命中数和最新的日志
+	Preview(index string, request LogRequest, options PreviewOptions) (SearchResult, error)
+}
+
+// NewLogBackend 按集群配置的 backend 创建日志后端，为空时为 Elasticsearch
+func NewLogBackend(config configs.ElasticsearchConfig) (LogBackend, error) {
+	switch config.Backend {
+	case "", BackendElasticsearch:
+		return NewElasticsearchBackend(config), nil
+	case BackendLoki:
+		return NewLokiBackend(config), nil
+	default:
+		return nil, fmt.Errorf("不支持的日志后端：%s", config.Backend)
+	}
+}
+
+func jsonPathStep(path string) map[string]string {
+	return map[string]string{
+		"type":                 "12",
+		"params":               path,
+		"error_handler":        "0",
+		"error_handler_params": "",
+	}
+}
+
+func javaScriptStep(script string) map[string]string {
+	return map[string]string{
+		"type":                 "21",
+		"params":               script,
+		"error_handler":        "0",
+		"error_handler_params": "",
+	}
+}
+
+// ElasticsearchBackend 使用 _search 统计 hits.total
+type ElasticsearchBackend struct {
+	es                    *Elasticsearch
+	url                   string
+	defaultTimestampField string
+}
+
+func NewElasticsearchBackend(config configs.ElasticsearchConfig) *ElasticsearchBackend {
+	es := NewElasticsearch(config)
+	return &ElasticsearchBackend{
+		es:                    es,
+		url:                   es.url,
+		defaultTimestampField: config.TimestampField,
+	}
+}
+
+// Client 返回 Elasticsearch 客户端，用于 profile、回测等 Elasticsearch 特有的功能
+func (b *ElasticsearchBackend) Client() *Elasticsearch {
+	return b.es
+}
+
+func (b *ElasticsearchBackend) Name() string {
+	return BackendElasticsearch
+}
+
+func (b *ElasticsearchBackend) Ping() error {
+	return b.es.Ping()
+}
+
+func (b *ElasticsearchBackend) BuildRequest(index string, query LogQuery) (LogRequest, error) {
+	timestampField, err := b.es.ResolveTimestampField(index, query.TimestampField, b.defaultTimestampField)
+	if err != nil {
+		return LogRequest{}, err
+	}
+	posts, err := BuildPosts(query.QueryString, query.Query, PostsOptions{
+		TimestampField: timestampField,
+		Window:         query.Window,
+		Lag:            query.Lag,
+		Flavor:         b.es.Flavor(),
+	})
+	if err != nil {
+		return LogRequest{}, err
+	}
+	return LogRequest{
+		Url:            fmt.Sprintf("%s/%s/_search", b.url, IndexPath(index)),
+		Posts:          posts,
+		Preprocessing:  []map[string]string{jsonPathStep(b.es.Flavor().TotalHitsPath())},
+		TimestampField: timestampField,
+	}, nil
+}
+
+// Validate 检查索引模式是否匹配到索引并用 _validate/query 校验查询，
+// _validate/query 不支持跨集群搜索，跨集群索引（remote:logs-*）改为执行一次 size 为 0 的查询
+func (b *ElasticsearchBackend) Validate(index string, request LogRequest) error {
+	if strings.Contains(index, ":") {
+		_, err := b.es.Search(index, []byte(request.Posts))
+		if err != nil {
+			return fmt.Errorf("查询语句无效：%s", err.Error())
+		}
+		return nil
+	}
+	indices, err := b.es.ResolveIndex(index)
+	if err != nil {
+		return err
+	}
+	if len(indices) == 0 {
+		return fmt.Errorf("索引模式未匹配到任何索引：%s", index)
+	}
+	valid, explanation, err := b.es.ValidateQuery(index, request.Posts)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return fmt.Errorf("查询语句无效：%s", explanation)
+	}
+	return nil
+}
+
+func (b *ElasticsearchBackend) Preview(index string, request LogRequest, options PreviewOptions) (SearchResult, error) {
+	body, err := PreviewBody(request.Posts, request.TimestampField, options)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	return b.es.Search(index, body)
+}
+
+// BuildPosts 根据 query_string 或查询 DSL 生成查询体，两者必须且只能提供一个
+func BuildPosts(queryString string, query json.RawMessage, options PostsOptions) (string, error) {
+	if queryString != "" && len(query) > 0 {
+		return "", fmt.Errorf("query_string 和 query 只能提供一个")
+	}
+	if len(query) > 0 {
+		return GenerateDSLPosts(query, options)
+	}
+	if queryString == "" {
+		return "", fmt.Errorf("query_string 和 query 不能同时为空")
+	}
+	return GeneratePosts(queryString, options)
+}
+
+// PreviewBody 在告警查询体的基础上返回命中文档，按时间倒序
+func PreviewBody(posts, timestampField string, options PreviewOptions) ([]byte, error) {
+	var body map[string]interface{}
+	err := json.Unmarshal([]byte(posts), &body)
+	if err != nil {
+		return nil, fmt.Errorf("解析查询体失败：%s", err.Error())
+	}
+	body["size"] = options.Size
+	body["sort"] = []map[string]string{{timestampField: "desc"}}
+	if len(options.Fields) > 0 {
+		body["_source"] = options.Fields
+	}
+	return json.Marshal(body)
+}
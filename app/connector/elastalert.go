@@ -0,0 +1,344 @@
+package connector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"sort"
+	"strings"
+)
+
+// 导入 ElastAlert 规则：frequency 和 flatline 规则映射为固定阈值的告警，
+// 统计窗口与阈值的对应关系与导出时相同；spike_type 为 up 的 spike 规则映射为动态基线告警
+
+// ElastAlertImport 从 ElastAlert 规则转换出的告警定义
+type ElastAlertImport struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	Index       string `json:"index"`
+	// 过滤条件只有一个 query_string 时为其查询语句，否则为空并使用 Query
+	QueryString    string          `json:"query_string"`
+	Query          json.RawMessage `json:"query,omitempty"`
+	TimestampField string          `json:"timestamp_field"`
+	Window         string          `json:"window"`
+	Lag            string          `json:"lag"`
+	// run_every，规则中没有时为空
+	Interval  string `json:"interval"`
+	Threshold string `json:"threshold"`
+	// spike 规则映射的动态基线，其他规则为空
+	Baseline *ElastAlertBaseline `json:"baseline,omitempty"`
+	// 无法映射、导入时忽略的字段，如通知方式和告警文本
+	Ignored []string `json:"ignored"`
+}
+
+// ElastAlertBaseline spike 规则对应的动态基线参数，分位数使用配置的默认值
+type ElastAlertBaseline struct {
+	// 基线上的余量百分比，由 spike_height 换算，如 spike_height 为 3 时为 200
+	Margin float64 `json:"margin"`
+}
+
+// elastAlertMappedFields 各类规则导入时都使用的字段
+var elastAlertMappedFields = map[string]bool{
+	"name":            true,
+	"description":     true,
+	"type":            true,
+	"index":           true,
+	"filter":          true,
+	"timestamp_field": true,
+	"timestamp_type":  true,
+	"timeframe":       true,
+	"query_delay":     true,
+	"run_every":       true,
+	"is_enabled":      true,
+}
+
+// elastAlertTypeFields 只有对应类型的规则才使用的字段，如 frequency 规则中的 threshold 会被忽略
+var elastAlertTypeFields = map[string][]string{
+	"frequency": {"num_events"},
+	"flatline":  {"threshold"},
+	"spike":     {"spike_height", "spike_type", "threshold_cur"},
+}
+
+// elastAlertBlockingFields 改变计数方式的字段，映射为单一计数会改变告警含义，规则不能导入
+var elastAlertBlockingFields = map[string]string{
+	"query_key":          "按字段值分别计数",
+	"compound_query_key": "按字段值分别计数",
+	"use_terms_query":    "按字段值分别计数",
+	"use_strftime_index": "按日期生成索引名称",
+}
+
+// elastAlertSeconds ElastAlert 时间参数对应的秒数
+var elastAlertSeconds = map[string]int{
+	"weeks":   7 * 24 * 3600,
+	"days":    24 * 3600,
+	"hours":   3600,
+	"minutes": 60,
+	"seconds": 1,
+}
+
+// ParseElastAlertRules 解析规则文件，一个文件中可以有多个以 --- 分隔的规则
+func ParseElastAlertRules(data []byte) ([]map[string]interface{}, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	var rules []map[string]interface{}
+	for n := 1; ; n++ {
+		var rule map[string]interface{}
+		err := decoder.Decode(&rule)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 个规则解析失败：%s", n, err.Error())
+		}
+		if rule == nil {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// elastAlertDurationString 将 {minutes: 15} 形式的时间参数转换为 15m，取能整除的最大单位
+func elastAlertDurationString(field string, value interface{}) (string, error) {
+	units, ok := value.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("%s 不是时间参数：%v", field, value)
+	}
+	total := 0
+	for unit, n := range units {
+		seconds, ok := elastAlertSeconds[unit]
+		if !ok {
+			return "", fmt.Errorf("%s 中不支持的时间单位：%s", field, unit)
+		}
+		number, ok := elastAlertNumber(n)
+		if !ok || number != float64(int(number)) {
+			return "", fmt.Errorf("%s.%s 不是整数：%v", field, unit, n)
+		}
+		total += int(number) * seconds
+	}
+	if total <= 0 {
+		return "", fmt.Errorf("%s 必须大于 0", field)
+	}
+	for _, unit := range []string{"w", "d", "h", "m"} {
+		seconds := elastAlertSeconds[elastAlertUnits[unit[0]]]
+		if total%seconds == 0 {
+			return fmt.Sprintf("%d%s", total/seconds, unit), nil
+		}
+	}
+	return fmt.Sprintf("%ds", total), nil
+}
+
+func elastAlertNumber(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+func elastAlertString(rule map[string]interface{}, field string) (string, error) {
+	value, ok := rule[field]
+	if !ok || value == nil {
+		return "", nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s 不是字符串：%v", field, value)
+	}
+	return s, nil
+}
+
+// elastAlertQuery 将 filter 列表转换为查询：旧写法 {query: {...}} 去掉外层，
+// 只有一个 query_string 时返回查询语句，多个条件组合为 bool.filter
+func elastAlertQuery(filter interface{}) (string, json.RawMessage, error) {
+	if filter == nil {
+		return "*", nil, nil
+	}
+	items, ok := filter.([]interface{})
+	if !ok {
+		return "", nil, fmt.Errorf("filter 不是列表")
+	}
+	var clauses []interface{}
+	for _, item := range items {
+		clause, ok := item.(map[string]interface{})
+		if !ok || len(clause) != 1 {
+			return "", nil, fmt.Errorf("filter 中的条件格式错误：%v", item)
+		}
+		if inner, ok := clause["query"]; ok {
+			clause, ok = inner.(map[string]interface{})
+			if !ok {
+				return "", nil, fmt.Errorf("filter 中的条件格式错误：%v", item)
+			}
+		}
+		clauses = append(clauses, clause)
+	}
+	if len(clauses) == 0 {
+		return "*", nil, nil
+	}
+	if len(clauses) == 1 {
+		clause := clauses[0].(map[string]interface{})
+		if queryString, ok := clause["query_string"].(map[string]interface{}); ok && len(clause) == 1 && len(queryString) == 1 {
+			if query, ok := queryString["query"].(string); ok {
+				return query, nil, nil
+			}
+		}
+		dsl, err := json.Marshal(clause)
+		if err != nil {
+			return "", nil, fmt.Errorf("JSON编码失败：%s", err.Error())
+		}
+		return "", dsl, nil
+	}
+	dsl, err := json.Marshal(map[string]interface{}{
+		"bool": map[string]interface{}{"filter": clauses},
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("JSON编码失败：%s", err.Error())
+	}
+	return "", dsl, nil
+}
+
+// ConvertElastAlertRule 将 ElastAlert 规则转换为告警定义：frequency 的 num_events 对应阈值 >=N，
+// flatline 的 threshold 对应阈值 <N，spike 的 spike_height 对应动态基线的余量，
+// timeframe 对应统计窗口，query_delay 对应入库延迟。
+// 规则类型或计数方式无法映射时返回错误，其他无法映射的字段记录在 Ignored 中
+func ConvertElastAlertRule(rule map[string]interface{}) (ElastAlertImport, error) {
+	var result ElastAlertImport
+	var err error
+	result.Name, err = elastAlertString(rule, "name")
+	if err != nil {
+		return result, err
+	}
+	result.Type, err = elastAlertString(rule, "type")
+	if err != nil {
+		return result, err
+	}
+	result.Index, err = elastAlertString(rule, "index")
+	if err != nil {
+		return result, err
+	}
+	result.Description, err = elastAlertString(rule, "description")
+	if err != nil {
+		return result, err
+	}
+	result.TimestampField, err = elastAlertString(rule, "timestamp_field")
+	if err != nil {
+		return result, err
+	}
+	if result.TimestampField == "" {
+		result.TimestampField = "@timestamp"
+	}
+
+	typeFields := map[string]bool{}
+	for _, field := range elastAlertTypeFields[result.Type] {
+		typeFields[field] = true
+	}
+	result.Ignored = []string{}
+	for field := range rule {
+		if !elastAlertMappedFields[field] && !typeFields[field] {
+			result.Ignored = append(result.Ignored, field)
+		}
+	}
+	sort.Strings(result.Ignored)
+
+	if result.Name == "" {
+		return result, errors.New("规则没有 name")
+	}
+	if result.Index == "" {
+		return result, errors.New("规则没有 index")
+	}
+	// 多个索引以逗号分隔，与 ElastAlert 相同在一次查询中合并计数
+	indices := strings.Split(result.Index, ",")
+	for i, index := range indices {
+		indices[i] = strings.TrimSpace(index)
+		if indices[i] == "" {
+			return result, fmt.Errorf("index 中有空的索引名：%s", result.Index)
+		}
+	}
+	result.Index = strings.Join(indices, ",")
+	if enabled, ok := rule["is_enabled"].(bool); ok && !enabled {
+		return result, errors.New("规则已停用（is_enabled: false）")
+	}
+	for _, field := range result.Ignored {
+		if reason, ok := elastAlertBlockingFields[field]; ok {
+			return result, fmt.Errorf("不支持 %s（%s）", field, reason)
+		}
+	}
+	if timestampType, _ := rule["timestamp_type"].(string); timestampType != "" && timestampType != "iso" {
+		return result, fmt.Errorf("不支持 timestamp_type: %s", timestampType)
+	}
+
+	switch result.Type {
+	case "frequency":
+		number, ok := elastAlertNumber(rule["num_events"])
+		if !ok {
+			return result, errors.New("frequency 规则没有 num_events")
+		}
+		result.Threshold = fmt.Sprintf(">=%g", number)
+	case "flatline":
+		number, ok := elastAlertNumber(rule["threshold"])
+		if !ok {
+			return result, errors.New("flatline 规则没有 threshold")
+		}
+		result.Threshold = fmt.Sprintf("<%g", number)
+	case "spike":
+		// 动态基线以历史同一“周内小时”的分位数代替上一窗口的数量，只在高于基线时触发
+		spikeType, _ := rule["spike_type"].(string)
+		if spikeType != "up" {
+			return result, fmt.Errorf("不支持 spike_type: %v，动态基线只能映射 spike_type 为 up 的规则", rule["spike_type"])
+		}
+		height, ok := elastAlertNumber(rule["spike_height"])
+		if !ok {
+			return result, errors.New("spike 规则没有 spike_height")
+		}
+		if height <= 1 {
+			return result, fmt.Errorf("spike_height 必须大于 1：%g", height)
+		}
+		result.Baseline = &ElastAlertBaseline{Margin: (height - 1) * 100}
+		// threshold_cur 为当前窗口的最小数量，作为第一次计算基线之前的阈值
+		current := 0.0
+		if value, ok := rule["threshold_cur"]; ok {
+			current, ok = elastAlertNumber(value)
+			if !ok {
+				return result, fmt.Errorf("threshold_cur 不是数字：%v", value)
+			}
+		}
+		result.Threshold = fmt.Sprintf(">%g", current)
+	case "":
+		return result, errors.New("规则没有 type")
+	default:
+		return result, fmt.Errorf("不支持 %s 规则", result.Type)
+	}
+
+	if _, ok := rule["timeframe"]; !ok {
+		return result, fmt.Errorf("%s 规则没有 timeframe", result.Type)
+	}
+	result.Window, err = elastAlertDurationString("timeframe", rule["timeframe"])
+	if err != nil {
+		return result, err
+	}
+	if value, ok := rule["query_delay"]; ok {
+		result.Lag, err = elastAlertDurationString("query_delay", value)
+		if err != nil {
+			return result, err
+		}
+	}
+	if value, ok := rule["run_every"]; ok {
+		result.Interval, err = elastAlertDurationString("run_every", value)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	result.QueryString, result.Query, err = elastAlertQuery(rule["filter"])
+	if err != nil {
+		return result, err
+	}
+	result.Description = strings.TrimSpace(result.Description)
+	return result, nil
+}
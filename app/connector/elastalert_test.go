@@ -0,0 +1,127 @@
+package connector
+
+import "testing"
+
+func parseElastAlertRule(t *testing.T, data string) map[string]interface{} {
+	t.Helper()
+	rules, err := ParseElastAlertRules([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 {
+		t.Fatalf("got %d rules, want 1", len(rules))
+	}
+	return rules[0]
+}
+
+func TestConvertElastAlertSpike(t *testing.T) {
+	rule := parseElastAlertRule(t, `
+name: error spike
+type: spike
+index: logs-*
+spike_height: 3
+spike_type: up
+threshold_cur: 5
+threshold_ref: 10
+timeframe:
+  hours: 1
+`)
+	result, err := ConvertElastAlertRule(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Baseline == nil || result.Baseline.Margin != 200 {
+		t.Errorf("Baseline = %+v, want margin 200", result.Baseline)
+	}
+	if result.Threshold != ">5" {
+		t.Errorf("Threshold = %q, want >5", result.Threshold)
+	}
+	if len(result.Ignored) != 1 || result.Ignored[0] != "threshold_ref" {
+		t.Errorf("Ignored = %v, want [threshold_ref]", result.Ignored)
+	}
+}
+
+func TestConvertElastAlertSpikeRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+	}{
+		{"spike down", "spike_type: down\nspike_height: 3"},
+		{"spike both", "spike_type: both\nspike_height: 3"},
+		{"no spike_type", "spike_height: 3"},
+		{"no spike_height", "spike_type: up"},
+		{"spike_height not above 1", "spike_type: up\nspike_height: 1"},
+	}
+	for _, test := range tests {
+		rule := parseElastAlertRule(t, "name: spike\ntype: spike\nindex: logs-*\ntimeframe:\n  hours: 1\n"+test.rule)
+		if result, err := ConvertElastAlertRule(rule); err == nil {
+			t.Errorf("%s: ConvertElastAlertRule accepted %+v", test.name, result)
+		}
+	}
+}
+
+func TestConvertElastAlertTimeframe(t *testing.T) {
+	tests := []struct {
+		timeframe string
+		want      string
+	}{
+		{"{minutes: 15}", "15m"},
+		{"{seconds: 90}", "90s"},
+		{"{seconds: 120}", "2m"},
+		{"{minutes: 90}", "90m"},
+		{"{minutes: 120}", "2h"},
+		{"{hours: 24}", "1d"},
+		{"{hours: 36}", "36h"},
+		{"{days: 14}", "2w"},
+		{"{weeks: 1}", "1w"},
+		{"{hours: 1, minutes: 30}", "90m"},
+		{"{days: 1, hours: 12}", "36h"},
+	}
+	for _, test := range tests {
+		rule := parseElastAlertRule(t, "name: errors\ntype: frequency\nindex: logs-*\nnum_events: 10\ntimeframe: "+test.timeframe)
+		result, err := ConvertElastAlertRule(rule)
+		if err != nil {
+			t.Errorf("timeframe %s: %v", test.timeframe, err)
+			continue
+		}
+		if result.Window != test.want {
+			t.Errorf("timeframe %s: Window = %q, want %q", test.timeframe, result.Window, test.want)
+		}
+	}
+}
+
+func TestConvertElastAlertTimeframeRejects(t *testing.T) {
+	for _, timeframe := range []string{"15", "{minutes: 0}", "{minutes: 1.5}", "{months: 1}", "{minutes: ten}"} {
+		rule := parseElastAlertRule(t, "name: errors\ntype: frequency\nindex: logs-*\nnum_events: 10\ntimeframe: "+timeframe)
+		if result, err := ConvertElastAlertRule(rule); err == nil {
+			t.Errorf("timeframe %s: ConvertElastAlertRule accepted window %q", timeframe, result.Window)
+		}
+	}
+	rule := parseElastAlertRule(t, "name: errors\ntype: frequency\nindex: logs-*\nnum_events: 10")
+	if _, err := ConvertElastAlertRule(rule); err == nil {
+		t.Error("ConvertElastAlertRule accepted a rule without timeframe")
+	}
+}
+
+func TestConvertElastAlertQueryDelayAndRunEvery(t *testing.T) {
+	rule := parseElastAlertRule(t, `
+name: errors
+type: flatline
+index: logs-*
+threshold: 3
+timeframe:
+  hours: 1
+query_delay:
+  seconds: 30
+run_every:
+  minutes: 5
+`)
+	result, err := ConvertElastAlertRule(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Window != "1h" || result.Lag != "30s" || result.Interval != "5m" || result.Threshold != "<3" {
+		t.Errorf("ConvertElastAlertRule() = window %q, lag %q, interval %q, threshold %q, want 1h, 30s, 5m, <3",
+			result.Window, result.Lag, result.Interval, result.Threshold)
+	}
+}
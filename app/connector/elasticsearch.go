@@ -0,0 +1,604 @@
+package connector
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gin-zabbix/configs"
+	"io"
+	"net/http"
+	netUrl "net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Elasticsearch struct {
+	url      string
+	username string
+	password string
+	apiKey   string
+	flavor   Flavor
+	client   *http.Client
+	// 创建客户端时的配置错误，例如 CA 文件无法读取，在发送请求时返回
+	err error
+}
+
+type ElasticsearchError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+func NewElasticsearch(config configs.ElasticsearchConfig) *Elasticsearch {
+	tlsConfig, err := newTLSConfig(config)
+	flavor, flavorErr := ParseFlavor(config.Flavor)
+	if err == nil {
+		err = flavorErr
+	}
+	tr := &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: tr,
+	}
+	return &Elasticsearch{
+		url:      strings.TrimSuffix(config.Url, "/"),
+		username: config.Username,
+		password: config.Password,
+		apiKey:   config.ApiKey,
+		flavor:   flavor,
+		client:   client,
+		err:      err,
+	}
+}
+
+// newTLSConfig 配置了 CA 文件时用其校验证书，配置了 CA 指纹时要求证书链中有指纹相同的证书，
+// 都未配置时保持原有行为，不校验证书
+func newTLSConfig(config configs.ElasticsearchConfig) (*tls.Config, error) {
+	if config.CaFile == "" && config.CaFingerprint == "" {
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if config.CaFile != "" {
+		data, err := os.ReadFile(config.CaFile)
+		if err != nil {
+			return tlsConfig, fmt.Errorf("读取CA文件失败：%s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return tlsConfig, fmt.Errorf("CA文件中没有有效的证书：%s", config.CaFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.CaFingerprint != "" {
+		fingerprint := strings.ToLower(strings.ReplaceAll(config.CaFingerprint, ":", ""))
+		// 只配置指纹时由指纹代替 CA 链校验
+		tlsConfig.InsecureSkipVerify = config.CaFile == ""
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			for _, raw := range rawCerts {
+				sum := sha256.Sum256(raw)
+				if hex.EncodeToString(sum[:]) == fingerprint {
+					return nil
+				}
+			}
+			return fmt.Errorf("证书链中没有与 CA 指纹匹配的证书")
+		}
+	}
+	return tlsConfig, nil
+}
+
+// indexPathUnescaper 通配符和逗号在路径中无需转义，保留原样便于阅读
+var indexPathUnescaper = strings.NewReplacer("%2A", "*", "%2C", ",")
+
+// IndexPath 转义 URL 路径中的索引名，如日期运算 <logs-{now/d}> 中的 "/"
+func IndexPath(index string) string {
+	return indexPathUnescaper.Replace(netUrl.PathEscape(index))
+}
+
+// RequestApi 返回响应体和 HTTP 状态码，非 2xx 状态码不视为错误，由调用方解析
+func (e *Elasticsearch) RequestApi(method, path string, body []byte) ([]byte, int, error) {
+	if e.err != nil {
+		return nil, 0, e.err
+	}
+	req, err := http.NewRequest(method, e.url+path, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, 0, fmt.Errorf("创建HTTP请求失败：%s", err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("ApiKey %s", e.apiKey))
+	} else if e.username != "" {
+		req.SetBasicAuth(e.username, e.password)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("发送HTTP请求失败：%s", err.Error())
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(resp.Body)
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取响应失败：%s", err.Error())
+	}
+
+	return responseBody, resp.StatusCode, nil
+}
+
+// parseError 提取 Elasticsearch 错误响应中的原因
+func parseError(responseBody []byte, statusCode int) error {
+	var response struct {
+		Error ElasticsearchError `json:"error"`
+	}
+	err := json.Unmarshal(responseBody, &response)
+	if err != nil || response.Error.Reason == "" {
+		return fmt.Errorf("HTTP %d：%s", statusCode, string(responseBody))
+	}
+	return fmt.Errorf("%s：%s", response.Error.Type, response.Error.Reason)
+}
+
+func (e *Elasticsearch) Ping() error {
+	responseBody, statusCode, err := e.RequestApi("GET", "/", nil)
+	if err != nil {
+		return fmt.Errorf("请求Elasticsearch失败：%s", err.Error())
+	}
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("Elasticsearch不可用：%s", parseError(responseBody, statusCode).Error())
+	}
+	return nil
+}
+
+func (e *Elasticsearch) Flavor() Flavor {
+	return e.flavor
+}
+
+// resolveResponse _resolve/index 的响应
+type resolveResponse struct {
+	Indices []struct {
+		Name string `json:"name"`
+	} `json:"indices"`
+	Aliases []struct {
+		Name    string   `json:"name"`
+		Indices []string `json:"indices"`
+	} `json:"aliases"`
+	DataStreams []struct {
+		Name           string   `json:"name"`
+		BackingIndices []string `json:"backing_indices"`
+	} `json:"data_streams"`
+}
+
+func (e *Elasticsearch) resolveIndex(pattern string) (resolveResponse, error) {
+	path := fmt.Sprintf("/_resolve/index/%s", IndexPath(pattern))
+	responseBody, statusCode, err := e.RequestApi("GET", path, nil)
+	if err != nil {
+		return resolveResponse{}, fmt.Errorf("请求Elasticsearch失败：%s", err.Error())
+	}
+	if statusCode != http.StatusOK {
+		return resolveResponse{}, fmt.Errorf("解析索引失败：%s", parseError(responseBody, statusCode).Error())
+	}
+
+	var response resolveResponse
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return resolveResponse{}, fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+	return response, nil
+}
+
+// ResolveIndex 返回索引模式匹配到的索引、别名和数据流名称
+func (e *Elasticsearch) ResolveIndex(pattern string) ([]string, error) {
+	if !e.flavor.SupportsResolveIndex() {
+		return e.catIndices(pattern)
+	}
+	response, err := e.resolveIndex(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, index := range response.Indices {
+		names = append(names, index.Name)
+	}
+	for _, alias := range response.Aliases {
+		names = append(names, alias.Name)
+	}
+	for _, dataStream := range response.DataStreams {
+		names = append(names, dataStream.Name)
+	}
+	return names, nil
+}
+
+type IndexInfo struct {
+	Name string `json:"name"`
+	// index、alias 或 data_stream
+	Type     string `json:"type"`
+	DocCount int64  `json:"doc_count"`
+	// 别名或数据流指向的索引
+	Indices []string `json:"indices,omitempty"`
+}
+
+// DiscoverIndices 返回索引模式匹配到的索引、别名和数据流及其文档数，
+// 别名和数据流的文档数为其指向索引的文档数之和，跨集群索引不统计文档数
+func (e *Elasticsearch) DiscoverIndices(pattern string) ([]IndexInfo, error) {
+	counts := map[string]int64{}
+	if !strings.Contains(pattern, ":") {
+		var err error
+		counts, err = e.docCounts(pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var infos []IndexInfo
+	if !e.flavor.SupportsResolveIndex() {
+		for name, count := range counts {
+			infos = append(infos, IndexInfo{Name: name, Type: "index", DocCount: count})
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+		return infos, nil
+	}
+
+	response, err := e.resolveIndex(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sum := func(indices []string) int64 {
+		var total int64
+		for _, index := range indices {
+			total += counts[index]
+		}
+		return total
+	}
+	for _, index := range response.Indices {
+		infos = append(infos, IndexInfo{Name: index.Name, Type: "index", DocCount: counts[index.Name]})
+	}
+	for _, alias := range response.Aliases {
+		infos = append(infos, IndexInfo{Name: alias.Name, Type: "alias", DocCount: sum(alias.Indices), Indices: alias.Indices})
+	}
+	for _, dataStream := range response.DataStreams {
+		infos = append(infos, IndexInfo{Name: dataStream.Name, Type: "data_stream", DocCount: sum(dataStream.BackingIndices), Indices: dataStream.BackingIndices})
+	}
+	return infos, nil
+}
+
+// docCounts 使用 _stats 统计索引模式展开后每个索引的主分片文档数，别名和数据流会展开为实际索引
+func (e *Elasticsearch) docCounts(pattern string) (map[string]int64, error) {
+	path := fmt.Sprintf("/%s/_stats/docs?level=indices", IndexPath(pattern))
+	responseBody, statusCode, err := e.RequestApi("GET", path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("请求Elasticsearch失败：%s", err.Error())
+	}
+	if statusCode == http.StatusNotFound {
+		return map[string]int64{}, nil
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("统计文档数失败：%s", parseError(responseBody, statusCode).Error())
+	}
+
+	var response struct {
+		Indices map[string]struct {
+			Primaries struct {
+				Docs struct {
+					Count int64 `json:"count"`
+				} `json:"docs"`
+			} `json:"primaries"`
+		} `json:"indices"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return nil, fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	counts := map[string]int64{}
+	for name, stats := range response.Indices {
+		counts[name] = stats.Primaries.Docs.Count
+	}
+	return counts, nil
+}
+
+// catIndices 不支持 _resolve/index 的版本使用 _cat/indices，别名会展开为其指向的索引
+func (e *Elasticsearch) catIndices(pattern string) ([]string, error) {
+	path := fmt.Sprintf("/_cat/indices/%s?format=json&h=index", IndexPath(pattern))
+	responseBody, statusCode, err := e.RequestApi("GET", path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("请求Elasticsearch失败：%s", err.Error())
+	}
+	if statusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("解析索引失败：%s", parseError(responseBody, statusCode).Error())
+	}
+
+	var response []struct {
+		Index string `json:"index"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return nil, fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	var names []string
+	for _, index := range response {
+		names = append(names, index.Index)
+	}
+	return names, nil
+}
+
+// ValidateQuery 使用 _validate/query 校验查询体，无效时返回 Elasticsearch 的解释
+func (e *Elasticsearch) ValidateQuery(index, posts string) (bool, string, error) {
+	// _validate/query 只接受 query 字段
+	var body struct {
+		Query json.RawMessage `json:"query"`
+	}
+	err := json.Unmarshal([]byte(posts), &body)
+	if err != nil {
+		return false, fmt.Sprintf("查询体不是合法的 JSON：%s", err.Error()), nil
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return false, "", fmt.Errorf("JSON编码失败：%s", err.Error())
+	}
+
+	path := fmt.Sprintf("/%s/_validate/query?explain=true", IndexPath(index))
+	responseBody, statusCode, err := e.RequestApi("POST", path, data)
+	if err != nil {
+		return false, "", fmt.Errorf("请求Elasticsearch失败：%s", err.Error())
+	}
+	if statusCode != http.StatusOK {
+		return false, parseError(responseBody, statusCode).Error(), nil
+	}
+
+	var response struct {
+		Valid        bool `json:"valid"`
+		Explanations []struct {
+			Index string `json:"index"`
+			Valid bool   `json:"valid"`
+			Error string `json:"error"`
+		} `json:"explanations"`
+		Error string `json:"error"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return false, "", fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Valid {
+		return true, "", nil
+	}
+	for _, explanation := range response.Explanations {
+		if !explanation.Valid && explanation.Error != "" {
+			return false, explanation.Error, nil
+		}
+	}
+	return false, response.Error, nil
+}
+
+type SearchHit struct {
+	Index  string                 `json:"_index"`
+	ID     string                 `json:"_id"`
+	Source map[string]interface{} `json:"_source"`
+}
+
+type SearchResult struct {
+	Total        int64                      `json:"total"`
+	Hits         []SearchHit                `json:"hits"`
+	Aggregations map[string]json.RawMessage `json:"aggregations"`
+}
+
+// Search 执行查询，hits.total 兼容 6.x 的数字和 7.x 以后的对象两种格式
+func (e *Elasticsearch) Search(index string, body []byte) (SearchResult, error) {
+	path := fmt.Sprintf("/%s/_search", IndexPath(index))
+	responseBody, statusCode, err := e.RequestApi("POST", path, body)
+	if err != nil {
+		return SearchResult{}, fmt.Errorf("请求Elasticsearch失败：%s", err.Error())
+	}
+	if statusCode != http.StatusOK {
+		return SearchResult{}, fmt.Errorf("查询失败：%s", parseError(responseBody, statusCode).Error())
+	}
+
+	var response struct {
+		Hits struct {
+			Total json.RawMessage `json:"total"`
+			Hits  []SearchHit     `json:"hits"`
+		} `json:"hits"`
+		Aggregations map[string]json.RawMessage `json:"aggregations"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return SearchResult{}, fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	var total struct {
+		Value int64 `json:"value"`
+	}
+	err = json.Unmarshal(response.Hits.Total, &total)
+	if err != nil {
+		err = json.Unmarshal(response.Hits.Total, &total.Value)
+		if err != nil {
+			return SearchResult{}, fmt.Errorf("解析命中数失败：%s", err.Error())
+		}
+	}
+
+	return SearchResult{
+		Total:        total.Value,
+		Hits:         response.Hits.Hits,
+		Aggregations: response.Aggregations,
+	}, nil
+}
+
+type ProfileResult struct {
+	// 请求总耗时
+	TookMillis int64 `json:"took_ms"`
+	// 各分片查询阶段耗时之和
+	QueryMillis float64 `json:"query_ms"`
+	Shards      int     `json:"shards"`
+}
+
+// Profile 使用 _search?profile=true 执行一次查询，返回耗时统计
+func (e *Elasticsearch) Profile(index string, body []byte) (ProfileResult, error) {
+	path := fmt.Sprintf("/%s/_search?profile=true", IndexPath(index))
+	responseBody, statusCode, err := e.RequestApi("POST", path, body)
+	if err != nil {
+		return ProfileResult{}, fmt.Errorf("请求Elasticsearch失败：%s", err.Error())
+	}
+	if statusCode != http.StatusOK {
+		return ProfileResult{}, fmt.Errorf("查询失败：%s", parseError(responseBody, statusCode).Error())
+	}
+
+	var response struct {
+		Took    int64 `json:"took"`
+		Profile struct {
+			Shards []struct {
+				Searches []struct {
+					Query []struct {
+						TimeInNanos int64 `json:"time_in_nanos"`
+					} `json:"query"`
+				} `json:"searches"`
+			} `json:"shards"`
+		} `json:"profile"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return ProfileResult{}, fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	var nanos int64
+	for _, shard := range response.Profile.Shards {
+		for _, search := range shard.Searches {
+			for _, query := range search.Query {
+				nanos += query.TimeInNanos
+			}
+		}
+	}
+	return ProfileResult{
+		TookMillis:  response.Took,
+		QueryMillis: float64(nanos) / float64(time.Millisecond),
+		Shards:      len(response.Profile.Shards),
+	}, nil
+}
+
+// DetectTimestampField 通过 _field_caps 按顺序返回 candidates 中第一个日期类型的字段，
+// 支持数据流和跨集群索引，都不是日期类型时返回空字符串
+func (e *Elasticsearch) DetectTimestampField(index string, candidates []string) (string, error) {
+	path := fmt.Sprintf("/%s/_field_caps?fields=%s", IndexPath(index), netUrl.QueryEscape(strings.Join(candidates, ",")))
+	responseBody, statusCode, err := e.RequestApi("GET", path, nil)
+	if err != nil {
+		return "", fmt.Errorf("请求Elasticsearch失败：%s", err.Error())
+	}
+	if statusCode != http.StatusOK {
+		return "", fmt.Errorf("获取字段信息失败：%s", parseError(responseBody, statusCode).Error())
+	}
+
+	var response struct {
+		Fields map[string]map[string]json.RawMessage `json:"fields"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return "", fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	for _, field := range candidates {
+		types := response.Fields[field]
+		_, isDate := types["date"]
+		_, isDateNanos := types["date_nanos"]
+		if isDate || isDateNanos {
+			return field, nil
+		}
+	}
+	return "", nil
+}
+
+// ResolveTimestampField 未指定时间字段时，从索引映射中识别常见的时间字段，识别不到则使用配置的默认值
+func (e *Elasticsearch) ResolveTimestampField(index, timestampField, defaultField string) (string, error) {
+	if timestampField != "" {
+		return timestampField, nil
+	}
+	candidates := []string{defaultField}
+	for _, field := range []string{"@timestamp", "event.created", "timestamp"} {
+		if field != defaultField {
+			candidates = append(candidates, field)
+		}
+	}
+	detected, err := e.DetectTimestampField(index, candidates)
+	if err != nil {
+		return "", err
+	}
+	if detected == "" {
+		return defaultField, nil
+	}
+	return detected, nil
+}
+
+type FieldInfo struct {
+	Name         string   `json:"name"`
+	Types        []string `json:"types"`
+	Searchable   bool     `json:"searchable"`
+	Aggregatable bool     `json:"aggregatable"`
+}
+
+// FieldCaps 通过 _field_caps 返回索引模式下匹配 fields 的字段及其类型，
+// 不同索引中类型不一致的字段会返回多个类型，元数据字段和 object 类型的父字段被忽略
+func (e *Elasticsearch) FieldCaps(index, fields string) ([]FieldInfo, error) {
+	if fields == "" {
+		fields = "*"
+	}
+	path := fmt.Sprintf("/%s/_field_caps?fields=%s", IndexPath(index), netUrl.QueryEscape(fields))
+	responseBody, statusCode, err := e.RequestApi("GET", path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("请求Elasticsearch失败：%s", err.Error())
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取字段信息失败：%s", parseError(responseBody, statusCode).Error())
+	}
+
+	type capability struct {
+		Searchable    bool `json:"searchable"`
+		Aggregatable  bool `json:"aggregatable"`
+		MetadataField bool `json:"metadata_field"`
+	}
+	var response struct {
+		Fields map[string]map[string]capability `json:"fields"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return nil, fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	var infos []FieldInfo
+	for name, types := range response.Fields {
+		// 6.x 没有 metadata_field 属性，元数据字段以下划线开头
+		if strings.HasPrefix(name, "_") {
+			continue
+		}
+		info := FieldInfo{Name: name}
+		for fieldType, caps := range types {
+			if caps.MetadataField || fieldType == "object" || fieldType == "nested" {
+				continue
+			}
+			info.Types = append(info.Types, fieldType)
+			info.Searchable = info.Searchable || caps.Searchable
+			info.Aggregatable = info.Aggregatable || caps.Aggregatable
+		}
+		if len(info.Types) == 0 {
+			continue
+		}
+		sort.Strings(info.Types)
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
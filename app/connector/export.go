@@ -0,0 +1,215 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"math"
+	"net/http"
+	netUrl "net/url"
+	"strconv"
+	"time"
+)
+
+// 导出告警定义：在 Elastic Stack 内执行的 Watcher 和 ElastAlert 2 规则
+
+// ExportDefinition 导出所需的告警定义，统计区间与监控项的查询体相同
+type ExportDefinition struct {
+	Name        string
+	Description string
+	Index       string
+	// 查询条件（query_string 或查询 DSL），不含时间范围
+	Query          json.RawMessage
+	TimestampField string
+	Window         string
+	Lag            string
+	// 检查周期，如 1m、60s
+	Interval string
+	// 阈值的比较运算符（>=、<=、<>、>、<、=）和数值
+	Operator string
+	Value    float64
+	Flavor   Flavor
+}
+
+// watcherOperators Zabbix 比较运算符对应的 Watcher compare 条件
+var watcherOperators = map[string]string{
+	">=": "gte",
+	"<=": "lte",
+	"<>": "not_eq",
+	">":  "gt",
+	"<":  "lt",
+	"=":  "eq",
+}
+
+// Watch 生成 Watcher 定义：按检查周期执行告警查询，命中数满足阈值时记录日志，
+// Elasticsearch 7 起通过 rest_total_hits_as_int 让 hits.total 保持数字
+func Watch(def ExportDefinition) (json.RawMessage, error) {
+	operator, ok := watcherOperators[def.Operator]
+	if !ok {
+		return nil, fmt.Errorf("不支持的阈值运算符：%s", def.Operator)
+	}
+	posts, err := generatePosts(def.Query, PostsOptions{
+		TimestampField: def.TimestampField,
+		Window:         def.Window,
+		Lag:            def.Lag,
+		Flavor:         def.Flavor,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]interface{}
+	err = json.Unmarshal([]byte(posts), &body)
+	if err != nil {
+		return nil, fmt.Errorf("解析查询体失败：%s", err.Error())
+	}
+	body["size"] = 0
+
+	request := map[string]interface{}{
+		"indices": []string{def.Index},
+		"body":    body,
+	}
+	if def.Flavor.TrackTotalHits() {
+		request["rest_total_hits_as_int"] = true
+	}
+	watch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":        def.Name,
+			"description": def.Description,
+			"index":       def.Index,
+			"threshold":   fmt.Sprintf("%s%g", def.Operator, def.Value),
+		},
+		"trigger": map[string]interface{}{
+			"schedule": map[string]string{"interval": def.Interval},
+		},
+		"input": map[string]interface{}{
+			"search": map[string]interface{}{"request": request},
+		},
+		"condition": map[string]interface{}{
+			"compare": map[string]interface{}{
+				"ctx.payload.hits.total": map[string]float64{operator: def.Value},
+			},
+		},
+		"actions": map[string]interface{}{
+			"log": map[string]interface{}{
+				"logging": map[string]string{
+					"text": "{{ctx.metadata.name}}：命中数 {{ctx.payload.hits.total}} 满足阈值 {{ctx.metadata.threshold}}",
+				},
+			},
+		},
+	}
+	return marshal(watch)
+}
+
+// ElastAlertRule ElastAlert 2 规则，字段顺序即导出的 YAML 顺序
+type ElastAlertRule struct {
+	Name           string         `yaml:"name"`
+	Description    string         `yaml:"description,omitempty"`
+	Type           string         `yaml:"type"`
+	Index          string         `yaml:"index"`
+	TimestampField string         `yaml:"timestamp_field,omitempty"`
+	NumEvents      int64          `yaml:"num_events,omitempty"`
+	Threshold      int64          `yaml:"threshold,omitempty"`
+	Timeframe      map[string]int `yaml:"timeframe"`
+	QueryDelay     map[string]int `yaml:"query_delay,omitempty"`
+	Filter         []interface{}  `yaml:"filter"`
+	Alert          []string       `yaml:"alert"`
+}
+
+// elastAlertUnits 时间长度单位对应的 ElastAlert 时间参数
+var elastAlertUnits = map[byte]string{
+	's': "seconds",
+	'm': "minutes",
+	'h': "hours",
+	'd': "days",
+	'w': "weeks",
+}
+
+func elastAlertDuration(s string) (map[string]int, error) {
+	duration, err := ParseDuration(s)
+	if err != nil {
+		return nil, err
+	}
+	unit, ok := elastAlertUnits[s[len(s)-1]]
+	if !ok {
+		return map[string]int{"seconds": int(duration / time.Second)}, nil
+	}
+	n, _ := strconv.Atoi(s[:len(s)-1])
+	return map[string]int{unit: n}, nil
+}
+
+// ElastAlert 生成 ElastAlert 2 规则：>=、> 使用 frequency（num_events），<、<= 使用 flatline（threshold），
+// ElastAlert 计数为整数，阈值按运算符取整；= 和 <> 没有对应的规则类型
+func ElastAlert(def ExportDefinition) (string, error) {
+	timeframe, err := elastAlertDuration(def.Window)
+	if err != nil {
+		return "", err
+	}
+	var filter interface{}
+	err = json.Unmarshal(def.Query, &filter)
+	if err != nil {
+		return "", fmt.Errorf("解析查询条件失败：%s", err.Error())
+	}
+	rule := ElastAlertRule{
+		Name:           def.Name,
+		Description:    def.Description,
+		Index:          def.Index,
+		TimestampField: def.TimestampField,
+		Timeframe:      timeframe,
+		Filter:         []interface{}{map[string]interface{}{"query": filter}},
+		Alert:          []string{"debug"},
+	}
+	if def.Lag != "" {
+		rule.QueryDelay, err = elastAlertDuration(def.Lag)
+		if err != nil {
+			return "", err
+		}
+	}
+	switch def.Operator {
+	case ">=":
+		rule.Type = "frequency"
+		rule.NumEvents = int64(math.Ceil(def.Value))
+	case ">":
+		rule.Type = "frequency"
+		rule.NumEvents = int64(math.Floor(def.Value)) + 1
+	case "<":
+		rule.Type = "flatline"
+		rule.Threshold = int64(math.Ceil(def.Value))
+	case "<=":
+		rule.Type = "flatline"
+		rule.Threshold = int64(math.Floor(def.Value)) + 1
+	default:
+		return "", fmt.Errorf("ElastAlert 不支持阈值运算符：%s", def.Operator)
+	}
+	if rule.NumEvents < 1 && rule.Type == "frequency" {
+		rule.NumEvents = 1
+	}
+	// 数量不会小于 0，flatline 的 threshold 小于 1 时规则永远不会触发
+	if rule.Threshold < 1 && rule.Type == "flatline" {
+		return "", fmt.Errorf("阈值 %s%g 永远不会触发，无法导出为 ElastAlert 规则", def.Operator, def.Value)
+	}
+
+	data, err := yaml.Marshal(rule)
+	if err != nil {
+		return "", fmt.Errorf("YAML编码失败：%s", err.Error())
+	}
+	return string(data), nil
+}
+
+// PutWatch 通过 _watcher API 创建或更新 watch，OpenSearch 没有 Watcher
+func (e *Elasticsearch) PutWatch(id string, watch json.RawMessage) error {
+	if e.flavor == OpenSearch1 || e.flavor == OpenSearch2 {
+		return fmt.Errorf("OpenSearch 不支持 Watcher")
+	}
+	path := fmt.Sprintf("/_watcher/watch/%s", netUrl.PathEscape(id))
+	if e.flavor == Elasticsearch6 {
+		path = fmt.Sprintf("/_xpack/watcher/watch/%s", netUrl.PathEscape(id))
+	}
+	responseBody, statusCode, err := e.RequestApi("PUT", path, watch)
+	if err != nil {
+		return fmt.Errorf("请求Elasticsearch失败：%s", err.Error())
+	}
+	if statusCode != http.StatusOK && statusCode != http.StatusCreated {
+		return fmt.Errorf("创建 watch 失败：%s", parseError(responseBody, statusCode).Error())
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package connector
+
+import (
+	"encoding/json"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"testing"
+)
+
+func TestElastAlertThreshold(t *testing.T) {
+	tests := []struct {
+		operator  string
+		value     float64
+		ruleType  string
+		numEvents int64
+		threshold int64
+	}{
+		{">=", 10, "frequency", 10, 0},
+		{">=", 9.5, "frequency", 10, 0},
+		{">=", 0, "frequency", 1, 0},
+		{">", 10, "frequency", 11, 0},
+		{">", 9.5, "frequency", 10, 0},
+		{">", 0, "frequency", 1, 0},
+		{"<", 10, "flatline", 0, 10},
+		{"<", 9.5, "flatline", 0, 10},
+		{"<=", 10, "flatline", 0, 11},
+		{"<=", 9.5, "flatline", 0, 10},
+		{"<=", 0, "flatline", 0, 1},
+	}
+	for _, test := range tests {
+		def := ExportDefinition{
+			Name:     "errors",
+			Index:    "logs-*",
+			Query:    json.RawMessage(`{"query_string":{"query":"level:error"}}`),
+			Window:   "15m",
+			Operator: test.operator,
+			Value:    test.value,
+		}
+		data, err := ElastAlert(def)
+		if err != nil {
+			t.Errorf("ElastAlert(%s%g): %v", test.operator, test.value, err)
+			continue
+		}
+		var rule ElastAlertRule
+		if err := yaml.Unmarshal([]byte(data), &rule); err != nil {
+			t.Fatal(err)
+		}
+		if rule.Type != test.ruleType || rule.NumEvents != test.numEvents || rule.Threshold != test.threshold {
+			t.Errorf("ElastAlert(%s%g) = type %s, num_events %d, threshold %d, want %s, %d, %d",
+				test.operator, test.value, rule.Type, rule.NumEvents, rule.Threshold, test.ruleType, test.numEvents, test.threshold)
+		}
+	}
+}
+
+func TestElastAlertRejects(t *testing.T) {
+	for _, threshold := range []struct {
+		operator string
+		value    float64
+	}{{"=", 1}, {"<>", 0}, {"<", 0}, {"<", -1}, {"<=", -1}} {
+		def := ExportDefinition{
+			Name:     "errors",
+			Index:    "logs-*",
+			Query:    json.RawMessage(`{"match_all":{}}`),
+			Window:   "15m",
+			Operator: threshold.operator,
+			Value:    threshold.value,
+		}
+		if data, err := ElastAlert(def); err == nil {
+			t.Errorf("ElastAlert(%s%g) accepted:\n%s", threshold.operator, threshold.value, data)
+		}
+	}
+}
+
+func TestElastAlertDuration(t *testing.T) {
+	tests := []struct {
+		duration string
+		want     map[string]int
+	}{
+		{"15m", map[string]int{"minutes": 15}},
+		{"1h", map[string]int{"hours": 1}},
+		{"2d", map[string]int{"days": 2}},
+		{"1w", map[string]int{"weeks": 1}},
+		{"30s", map[string]int{"seconds": 30}},
+		{"90", map[string]int{"seconds": 90}},
+	}
+	for _, test := range tests {
+		got, err := elastAlertDuration(test.duration)
+		if err != nil {
+			t.Errorf("elastAlertDuration(%q): %v", test.duration, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("elastAlertDuration(%q) = %v, want %v", test.duration, got, test.want)
+		}
+	}
+}
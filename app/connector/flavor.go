@@ -0,0 +1,52 @@
+package connector
+
+import "fmt"
+
+// Flavor 日志后端的类型和大版本，决定查询体和命中数的取值路径
+type Flavor string
+
+const (
+	Elasticsearch6 Flavor = "elasticsearch6"
+	Elasticsearch7 Flavor = "elasticsearch7"
+	Elasticsearch8 Flavor = "elasticsearch8"
+	OpenSearch1    Flavor = "opensearch1"
+	OpenSearch2    Flavor = "opensearch2"
+)
+
+// ParseFlavor 为空时按 Elasticsearch 7 处理，与之前的行为一致
+func ParseFlavor(flavor string) (Flavor, error) {
+	switch f := Flavor(flavor); f {
+	case "":
+		return Elasticsearch7, nil
+	case Elasticsearch6, Elasticsearch7, Elasticsearch8, OpenSearch1, OpenSearch2:
+		return f, nil
+	default:
+		return "", fmt.Errorf("不支持的后端类型：%s", flavor)
+	}
+}
+
+// TotalHitsPath Elasticsearch 6 的 hits.total 是数字，之后的版本是 {"value":..,"relation":..}
+func (f Flavor) TotalHitsPath() string {
+	if f == Elasticsearch6 {
+		return "$.body.hits.total"
+	}
+	return "$.body.hits.total.value"
+}
+
+// TrackTotalHits Elasticsearch 7 起默认只精确统计到 10000，需要显式开启 track_total_hits
+func (f Flavor) TrackTotalHits() bool {
+	return f != Elasticsearch6
+}
+
+// HistogramInterval date_histogram 的固定间隔参数名，fixed_interval 从 Elasticsearch 7.2 开始提供
+func (f Flavor) HistogramInterval() string {
+	if f == Elasticsearch6 {
+		return "interval"
+	}
+	return "fixed_interval"
+}
+
+// SupportsResolveIndex _resolve/index 从 Elasticsearch 7.9 开始提供，OpenSearch 继承自 7.10
+func (f Flavor) SupportsResolveIndex() bool {
+	return f != Elasticsearch6
+}
@@ -0,0 +1,480 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	netUrl "net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DiscoverOptions Kibana Discover 链接的参数
+type DiscoverOptions struct {
+	// 索引模式（数据视图）的 ID
+	DataView string
+	// kuery 或 lucene，Query 为空时将 Filter 作为自定义过滤条件
+	Language string
+	Query    string
+	Filter   json.RawMessage
+	From     string
+	To       string
+}
+
+// DiscoverURL 生成打开 Kibana Discover 的链接，应用状态和全局状态使用 rison 编码
+func DiscoverURL(kibanaURL string, options DiscoverOptions) string {
+	global := map[string]interface{}{
+		"time": map[string]interface{}{"from": options.From, "to": options.To},
+	}
+	app := map[string]interface{}{
+		"index": options.DataView,
+		"query": map[string]interface{}{"language": options.Language, "query": options.Query},
+	}
+	if options.Query == "" && len(options.Filter) > 0 {
+		var filter interface{}
+		if err := json.Unmarshal(options.Filter, &filter); err == nil {
+			app["filters"] = []interface{}{
+				map[string]interface{}{
+					"meta": map[string]interface{}{
+						"type":     "custom",
+						"key":      "query",
+						"value":    string(options.Filter),
+						"disabled": false,
+						"negate":   false,
+						"index":    options.DataView,
+					},
+					"query": filter,
+				},
+			}
+		}
+	}
+	return fmt.Sprintf("%s/app/discover#/?_g=%s&_a=%s",
+		strings.TrimRight(kibanaURL, "/"), risonQueryEscape(rison(global)), risonQueryEscape(rison(app)))
+}
+
+// risonUnescaper rison 的语法字符在 URL 的 hash 中无需转义，保留原样使链接更短、更易读；
+// 空格编码为 %20 而不是 +，Kibana 解析 hash 中的参数时不会把 + 还原为空格
+var risonUnescaper = strings.NewReplacer(
+	"%28", "(", "%29", ")", "%3A", ":", "%2C", ",", "%27", "'", "%21", "!", "%2A", "*", "%2F", "/", "+", "%20",
+)
+
+func risonQueryEscape(s string) string {
+	return risonUnescaper.Replace(netUrl.QueryEscape(s))
+}
+
+// risonID 不需要加引号的 rison 字符串
+var risonID = regexp.MustCompile(`^[a-zA-Z_./~][a-zA-Z0-9_./~-]*$`)
+
+// rison 将 JSON 值编码为 rison，对象的键按字典序输出
+func rison(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "!n"
+	case bool:
+		if value {
+			return "!t"
+		}
+		return "!f"
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(value)
+	case string:
+		if risonID.MatchString(value) {
+			return value
+		}
+		return "'" + strings.NewReplacer("!", "!!", "'", "!'").Replace(value) + "'"
+	case []interface{}:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			items = append(items, rison(item))
+		}
+		return "!(" + strings.Join(items, ",") + ")"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		items := make([]string, 0, len(keys))
+		for _, key := range keys {
+			items = append(items, rison(key)+":"+rison(value[key]))
+		}
+		return "(" + strings.Join(items, ",") + ")"
+	}
+	return rison(fmt.Sprint(v))
+}
+
+// parseRison 解析 rison 编码的值，对象解析为 map[string]interface{}，数组解析为 []interface{}
+func parseRison(s string) (interface{}, error) {
+	d := &risonDecoder{input: s}
+	value, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.input) {
+		return nil, fmt.Errorf("rison 解析失败，位置 %d：多余的内容", d.pos+1)
+	}
+	return value, nil
+}
+
+type risonDecoder struct {
+	input string
+	pos   int
+}
+
+func (d *risonDecoder) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("rison 解析失败，位置 %d：%s", d.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (d *risonDecoder) next() (byte, error) {
+	if d.pos >= len(d.input) {
+		return 0, d.errorf("内容不完整")
+	}
+	c := d.input[d.pos]
+	d.pos++
+	return c, nil
+}
+
+func (d *risonDecoder) value() (interface{}, error) {
+	c, err := d.next()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c == '(':
+		return d.object()
+	case c == '!':
+		c, err = d.next()
+		if err != nil {
+			return nil, err
+		}
+		switch c {
+		case '(':
+			return d.array()
+		case 't':
+			return true, nil
+		case 'f':
+			return false, nil
+		case 'n':
+			return nil, nil
+		}
+		return nil, d.errorf("无法识别的 !%c", c)
+	case c == '\'':
+		return d.quoted()
+	case c == '-' || '0' <= c && c <= '9':
+		start := d.pos - 1
+		for d.pos < len(d.input) && strings.IndexByte("0123456789.eE+-", d.input[d.pos]) >= 0 {
+			d.pos++
+		}
+		number, err := strconv.ParseFloat(d.input[start:d.pos], 64)
+		if err != nil {
+			return nil, d.errorf("无法解析数字 %s", d.input[start:d.pos])
+		}
+		return number, nil
+	case strings.IndexByte(risonNotIDChars, c) >= 0:
+		d.pos--
+		return nil, d.errorf("无法识别的字符 %q", c)
+	}
+	start := d.pos - 1
+	for d.pos < len(d.input) && strings.IndexByte(risonNotIDChars, d.input[d.pos]) < 0 {
+		d.pos++
+	}
+	return d.input[start:d.pos], nil
+}
+
+// risonNotIDChars 不能出现在不加引号的 rison 字符串中的字符
+const risonNotIDChars = " '!:(),*@$"
+
+func (d *risonDecoder) quoted() (string, error) {
+	var b strings.Builder
+	for {
+		c, err := d.next()
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case '\'':
+			return b.String(), nil
+		case '!':
+			c, err = d.next()
+			if err != nil {
+				return "", err
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+func (d *risonDecoder) object() (map[string]interface{}, error) {
+	object := map[string]interface{}{}
+	if d.pos < len(d.input) && d.input[d.pos] == ')' {
+		d.pos++
+		return object, nil
+	}
+	for {
+		key, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(string)
+		if !ok {
+			return nil, d.errorf("对象的键必须是字符串")
+		}
+		if c, err := d.next(); err != nil || c != ':' {
+			return nil, d.errorf("缺少 ':'")
+		}
+		object[name], err = d.value()
+		if err != nil {
+			return nil, err
+		}
+		c, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		if c == ')' {
+			return object, nil
+		}
+		if c != ',' {
+			return nil, d.errorf("需要 ',' 或 ')'")
+		}
+	}
+}
+
+func (d *risonDecoder) array() ([]interface{}, error) {
+	array := []interface{}{}
+	if d.pos < len(d.input) && d.input[d.pos] == ')' {
+		d.pos++
+		return array, nil
+	}
+	for {
+		value, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+		c, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		if c == ')' {
+			return array, nil
+		}
+		if c != ',' {
+			return nil, d.errorf("需要 ',' 或 ')'")
+		}
+	}
+}
+
+// SavedSearch 从 Kibana 已保存搜索或 Discover 链接中提取的查询
+type SavedSearch struct {
+	Title string
+	// 数据视图 ID，导出文件中包含该数据视图时 Index 为其索引模式
+	DataView string
+	Index    string
+	// kuery 或 lucene
+	Language string
+	Query    string
+	// 已启用的过滤条件，取反的条件已包装为 bool.must_not
+	Filters []json.RawMessage
+	// Discover 链接中的时间范围
+	From string
+	To   string
+}
+
+// ParseSavedSearches 解析 Saved Objects 导出的 NDJSON，返回其中所有类型为 search 的对象
+func ParseSavedSearches(ndjson string) ([]SavedSearch, error) {
+	type savedObject struct {
+		Type       string `json:"type"`
+		ID         string `json:"id"`
+		Attributes struct {
+			Title                 string `json:"title"`
+			KibanaSavedObjectMeta struct {
+				SearchSourceJSON string `json:"searchSourceJSON"`
+			} `json:"kibanaSavedObjectMeta"`
+		} `json:"attributes"`
+		References []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+			ID   string `json:"id"`
+		} `json:"references"`
+	}
+
+	var searches []savedObject
+	patterns := map[string]string{}
+	for n, line := range strings.Split(ndjson, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var object savedObject
+		err := json.Unmarshal([]byte(line), &object)
+		if err != nil {
+			return nil, fmt.Errorf("NDJSON 第 %d 行解析失败：%s", n+1, err.Error())
+		}
+		switch object.Type {
+		case "search":
+			searches = append(searches, object)
+		case "index-pattern":
+			patterns[object.ID] = object.Attributes.Title
+		}
+	}
+
+	var result []SavedSearch
+	for _, object := range searches {
+		var source struct {
+			Query        json.RawMessage          `json:"query"`
+			Filter       []map[string]interface{} `json:"filter"`
+			IndexRefName string                   `json:"indexRefName"`
+			Index        string                   `json:"index"`
+		}
+		err := json.Unmarshal([]byte(object.Attributes.KibanaSavedObjectMeta.SearchSourceJSON), &source)
+		if err != nil {
+			return nil, fmt.Errorf("已保存搜索 %s 的 searchSourceJSON 解析失败：%s", object.Attributes.Title, err.Error())
+		}
+		search := SavedSearch{Title: object.Attributes.Title, DataView: source.Index}
+		for _, reference := range object.References {
+			if reference.Name == source.IndexRefName {
+				search.DataView = reference.ID
+			}
+		}
+		search.Index = patterns[search.DataView]
+
+		var query interface{}
+		if len(source.Query) > 0 {
+			err = json.Unmarshal(source.Query, &query)
+			if err != nil {
+				return nil, fmt.Errorf("已保存搜索 %s 的查询解析失败：%s", object.Attributes.Title, err.Error())
+			}
+		}
+		filters := make([]interface{}, 0, len(source.Filter))
+		for _, filter := range source.Filter {
+			filters = append(filters, filter)
+		}
+		search.Language, search.Query, search.Filters = savedQuery(query, filters)
+		result = append(result, search)
+	}
+	return result, nil
+}
+
+// ParseDiscoverURL 解析 Discover 链接中 rison 编码的 _a 和 _g 参数
+func ParseDiscoverURL(discoverURL string) (SavedSearch, error) {
+	u, err := netUrl.Parse(discoverURL)
+	if err != nil {
+		return SavedSearch{}, fmt.Errorf("无法解析 Discover 链接：%s", err.Error())
+	}
+	params := u.Query()
+	// 参数通常在 hash 中，例如 #/?_g=...&_a=...
+	fragment := u.EscapedFragment()
+	if i := strings.Index(fragment, "?"); i >= 0 {
+		hashParams, err := netUrl.ParseQuery(fragment[i+1:])
+		if err != nil {
+			return SavedSearch{}, fmt.Errorf("无法解析 Discover 链接：%s", err.Error())
+		}
+		for key, values := range hashParams {
+			params[key] = values
+		}
+	}
+	if params.Get("_a") == "" {
+		return SavedSearch{}, fmt.Errorf("Discover 链接中没有查询状态 _a")
+	}
+
+	decode := func(name string) (map[string]interface{}, error) {
+		if params.Get(name) == "" {
+			return map[string]interface{}{}, nil
+		}
+		value, err := parseRison(params.Get(name))
+		if err != nil {
+			return nil, fmt.Errorf("%s 参数%s", name, err.Error())
+		}
+		state, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s 参数不是对象", name)
+		}
+		return state, nil
+	}
+	app, err := decode("_a")
+	if err != nil {
+		return SavedSearch{}, err
+	}
+	global, err := decode("_g")
+	if err != nil {
+		return SavedSearch{}, err
+	}
+
+	search := SavedSearch{}
+	// 8.x 使用 dataSource.dataViewId，之前的版本使用 index
+	if index, ok := app["index"].(string); ok {
+		search.DataView = index
+	}
+	if dataSource, ok := app["dataSource"].(map[string]interface{}); ok {
+		if dataViewID, ok := dataSource["dataViewId"].(string); ok {
+			search.DataView = dataViewID
+		}
+	}
+	if timeRange, ok := global["time"].(map[string]interface{}); ok {
+		search.From, _ = timeRange["from"].(string)
+		search.To, _ = timeRange["to"].(string)
+	}
+	var filters []interface{}
+	for _, state := range []map[string]interface{}{global, app} {
+		if list, ok := state["filters"].([]interface{}); ok {
+			filters = append(filters, list...)
+		}
+	}
+	search.Language, search.Query, search.Filters = savedQuery(app["query"], filters)
+	return search, nil
+}
+
+// savedQuery 提取查询语句和语法，转换过滤条件；旧版本以查询 DSL 保存的查询作为过滤条件
+func savedQuery(query interface{}, filters []interface{}) (string, string, []json.RawMessage) {
+	language, queryString := "kuery", ""
+	var clauses []json.RawMessage
+	if q, ok := query.(map[string]interface{}); ok {
+		if l, ok := q["language"].(string); ok {
+			language = l
+		}
+		switch value := q["query"].(type) {
+		case string:
+			queryString = value
+		case map[string]interface{}:
+			if data, err := marshal(value); err == nil {
+				clauses = append(clauses, data)
+			}
+		}
+	}
+
+	for _, item := range filters {
+		filter, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		meta, _ := filter["meta"].(map[string]interface{})
+		if disabled, _ := meta["disabled"].(bool); disabled {
+			continue
+		}
+		// 8.x 的条件在 query 中，7.x 的 exists、range 等条件与 meta 平级
+		var clause interface{} = filter["query"]
+		if clause == nil {
+			rest := map[string]interface{}{}
+			for key, value := range filter {
+				if key != "meta" && key != "$state" {
+					rest[key] = value
+				}
+			}
+			clause = rest
+		}
+		if negate, _ := meta["negate"].(bool); negate {
+			clause = map[string]interface{}{"bool": map[string]interface{}{"must_not": clause}}
+		}
+		data, err := marshal(clause)
+		if err != nil {
+			continue
+		}
+		clauses = append(clauses, data)
+	}
+	return language, queryString, clauses
+}
@@ -0,0 +1,466 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// KQL（Kibana Query Language）解析，按 Kibana 的规则翻译为查询 DSL：
+//   - and、or、not 不区分大小写，and 对应 bool.filter，or 对应 bool.should，not 对应 bool.must_not
+//   - field: value 对应 match，带引号的值对应 match_phrase，field: * 对应 exists
+//   - 值中未转义的 * 为通配符，对应 query_string
+//   - 不带字段的值在所有字段中查询，对应 multi_match
+//   - field < value 等对应 range，field: { ... } 对应 nested
+
+// kqlSpecial 未转义时不能出现在无引号值中的字符
+const kqlSpecial = `\():<>"*{}`
+
+// kqlLiteral 字段名或值，pattern 为转义后可用于 query_string 的通配符写法
+type kqlLiteral struct {
+	text     string
+	pattern  string
+	quoted   bool
+	wildcard bool
+}
+
+type kqlParser struct {
+	input []rune
+	pos   int
+	// nested 查询中的字段需要加上路径前缀
+	prefix string
+}
+
+// ParseKQL 将 KQL 翻译为查询 DSL，语法错误时返回出错的位置
+func ParseKQL(query string) (json.RawMessage, error) {
+	p := &kqlParser{input: []rune(query)}
+	p.skipSpace()
+	var clause interface{}
+	if p.eof() {
+		clause = map[string]interface{}{"match_all": map[string]interface{}{}}
+	} else {
+		var err error
+		clause, err = p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return nil, p.errorf("无法识别的内容 %q", string(p.input[p.pos:]))
+	}
+	data, err := marshal(clause)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (p *kqlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("KQL 语法错误，位置 %d：%s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *kqlParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *kqlParser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *kqlParser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+// keywordAt 判断 pos 处是否为后面跟着空白的关键字，not 之后也可以直接跟括号；
+// 关键字在输入末尾或右括号之前时也视为关键字，由 acceptKeyword 报告缺少表达式
+func (p *kqlParser) keywordAt(pos int, keyword string) bool {
+	end := pos + len(keyword)
+	if end > len(p.input) {
+		return false
+	}
+	if !strings.EqualFold(string(p.input[pos:end]), keyword) {
+		return false
+	}
+	if end == len(p.input) {
+		return true
+	}
+	next := p.input[end]
+	return unicode.IsSpace(next) || next == ')' || next == '}' || keyword == "not" && next == '('
+}
+
+// acceptKeyword 跳过空白后如果是关键字则消费掉，关键字之后没有表达式时返回错误
+func (p *kqlParser) acceptKeyword(keyword string) (bool, error) {
+	p.skipSpace()
+	if !p.keywordAt(p.pos, keyword) {
+		return false, nil
+	}
+	start := p.pos
+	p.pos += len(keyword)
+	p.skipSpace()
+	if p.eof() || p.peek() == ')' || p.peek() == '}' {
+		p.pos = start
+		return false, p.errorf("运算符 %s 之后缺少表达式", keyword)
+	}
+	return true, nil
+}
+
+func (p *kqlParser) expect(r rune) error {
+	p.skipSpace()
+	if p.peek() != r {
+		if p.eof() {
+			return p.errorf("缺少 %q", r)
+		}
+		return p.errorf("需要 %q，实际为 %q", r, p.peek())
+	}
+	p.pos++
+	return nil
+}
+
+func (p *kqlParser) parseOr() (interface{}, error) {
+	return p.parseBinary("or", p.parseAnd)
+}
+
+func (p *kqlParser) parseAnd() (interface{}, error) {
+	return p.parseBinary("and", p.parseNot)
+}
+
+// parseBinary 解析由 keyword 连接的若干个子表达式
+func (p *kqlParser) parseBinary(keyword string, next func() (interface{}, error)) (interface{}, error) {
+	first, err := next()
+	if err != nil {
+		return nil, err
+	}
+	clauses := []interface{}{first}
+	for {
+		ok, err := p.acceptKeyword(keyword)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		clause, err := next()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	if len(clauses) == 1 {
+		return first, nil
+	}
+	if keyword == "or" {
+		return map[string]interface{}{
+			"bool": map[string]interface{}{"should": clauses, "minimum_should_match": 1},
+		}, nil
+	}
+	return map[string]interface{}{"bool": map[string]interface{}{"filter": clauses}}, nil
+}
+
+func (p *kqlParser) parseNot() (interface{}, error) {
+	ok, err := p.acceptKeyword("not")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		clause, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"bool": map[string]interface{}{"must_not": clause}}, nil
+	}
+	return p.parseSubQuery()
+}
+
+func (p *kqlParser) parseSubQuery() (interface{}, error) {
+	p.skipSpace()
+	if p.peek() == '(' {
+		p.pos++
+		clause, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return clause, p.expect(')')
+	}
+
+	literal, err := p.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	switch p.peek() {
+	case ':':
+		p.pos++
+		p.skipSpace()
+		if p.peek() == '{' {
+			p.pos++
+			return p.parseNested(literal)
+		}
+		return p.parseListOfValues(p.field(literal))
+	case '<', '>':
+		return p.parseRange(p.field(literal))
+	}
+	// 不带字段的值
+	return valueClause("", literal), nil
+}
+
+// field 返回完整的字段名，nested 查询中加上路径前缀
+func (p *kqlParser) field(literal kqlLiteral) string {
+	if p.prefix == "" {
+		return literal.text
+	}
+	return p.prefix + "." + literal.text
+}
+
+func (p *kqlParser) parseNested(literal kqlLiteral) (interface{}, error) {
+	path := p.field(literal)
+	outer := p.prefix
+	p.prefix = path
+	clause, err := p.parseOr()
+	p.prefix = outer
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect('}'); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"nested": map[string]interface{}{
+			"path":       path,
+			"query":      clause,
+			"score_mode": "none",
+		},
+	}, nil
+}
+
+func (p *kqlParser) parseRange(field string) (interface{}, error) {
+	op := string(p.peek())
+	p.pos++
+	if p.peek() == '=' {
+		op += "="
+		p.pos++
+	}
+	p.skipSpace()
+	literal, err := p.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+	key := map[string]string{"<": "lt", "<=": "lte", ">": "gt", ">=": "gte"}[op]
+	return map[string]interface{}{
+		"range": map[string]interface{}{
+			field: map[string]string{key: literal.text},
+		},
+	}, nil
+}
+
+// parseListOfValues 字段后为单个值，或括号中由关键字连接的值列表，例如 status: (200 or 404)
+func (p *kqlParser) parseListOfValues(field string) (interface{}, error) {
+	p.skipSpace()
+	if p.peek() == '(' {
+		p.pos++
+		clause, err := p.parseValueOr(field)
+		if err != nil {
+			return nil, err
+		}
+		return clause, p.expect(')')
+	}
+	literal, err := p.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+	return valueClause(field, literal), nil
+}
+
+func (p *kqlParser) parseValueOr(field string) (interface{}, error) {
+	return p.parseBinary("or", func() (interface{}, error) { return p.parseValueAnd(field) })
+}
+
+func (p *kqlParser) parseValueAnd(field string) (interface{}, error) {
+	return p.parseBinary("and", func() (interface{}, error) { return p.parseValueNot(field) })
+}
+
+func (p *kqlParser) parseValueNot(field string) (interface{}, error) {
+	ok, err := p.acceptKeyword("not")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		clause, err := p.parseValueNot(field)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"bool": map[string]interface{}{"must_not": clause}}, nil
+	}
+	return p.parseListOfValues(field)
+}
+
+func (p *kqlParser) parseLiteral() (kqlLiteral, error) {
+	p.skipSpace()
+	if p.peek() == '"' {
+		return p.parseQuoted()
+	}
+	return p.parseUnquoted()
+}
+
+func (p *kqlParser) parseQuoted() (kqlLiteral, error) {
+	start := p.pos
+	p.pos++
+	var b strings.Builder
+	for !p.eof() {
+		r := p.input[p.pos]
+		p.pos++
+		switch r {
+		case '"':
+			return kqlLiteral{text: b.String(), quoted: true}, nil
+		case '\\':
+			if p.eof() {
+				p.pos = start
+				return kqlLiteral{}, p.errorf("引号未闭合")
+			}
+			b.WriteRune(unescapeWhitespace(p.input[p.pos]))
+			p.pos++
+		default:
+			b.WriteRune(r)
+		}
+	}
+	p.pos = start
+	return kqlLiteral{}, p.errorf("引号未闭合")
+}
+
+// parseUnquoted 无引号值可以包含空格，遇到特殊字符或前后带空白的关键字时结束
+func (p *kqlParser) parseUnquoted() (kqlLiteral, error) {
+	var text, pattern strings.Builder
+	wildcard := false
+	for !p.eof() {
+		r := p.input[p.pos]
+		switch {
+		case r == '\\':
+			p.pos++
+			if p.eof() {
+				return kqlLiteral{}, p.errorf("转义符后缺少字符")
+			}
+			if escaped, ok := p.escapedKeyword(); ok {
+				text.WriteString(escaped)
+				pattern.WriteString(escapeQueryString(escaped))
+				continue
+			}
+			r = unescapeWhitespace(p.input[p.pos])
+			p.pos++
+			text.WriteRune(r)
+			pattern.WriteString(escapeQueryString(string(r)))
+			continue
+		case r == '*':
+			wildcard = true
+			text.WriteRune(r)
+			pattern.WriteRune(r)
+		case strings.ContainsRune(kqlSpecial, r):
+			return p.endLiteral(text.String(), pattern.String(), wildcard)
+		case unicode.IsSpace(r):
+			next := p.pos
+			for next < len(p.input) && unicode.IsSpace(p.input[next]) {
+				next++
+			}
+			if next == len(p.input) || strings.ContainsRune(`():<>"{}`, p.input[next]) ||
+				p.keywordAt(next, "or") || p.keywordAt(next, "and") || p.keywordAt(next, "not") {
+				return p.endLiteral(text.String(), pattern.String(), wildcard)
+			}
+			text.WriteRune(r)
+			pattern.WriteString(escapeQueryString(string(r)))
+		default:
+			text.WriteRune(r)
+			pattern.WriteString(escapeQueryString(string(r)))
+		}
+		p.pos++
+	}
+	return p.endLiteral(text.String(), pattern.String(), wildcard)
+}
+
+func (p *kqlParser) endLiteral(text, pattern string, wildcard bool) (kqlLiteral, error) {
+	if text == "" {
+		if p.eof() {
+			return kqlLiteral{}, p.errorf("缺少字段或值")
+		}
+		return kqlLiteral{}, p.errorf("无法识别的字符 %q", p.peek())
+	}
+	return kqlLiteral{text: text, pattern: pattern, wildcard: wildcard}, nil
+}
+
+// escapedKeyword 转义的关键字（\and、\or、\not）按普通文本处理
+func (p *kqlParser) escapedKeyword() (string, bool) {
+	for _, keyword := range []string{"and", "or", "not"} {
+		end := p.pos + len(keyword)
+		if end <= len(p.input) && strings.EqualFold(string(p.input[p.pos:end]), keyword) {
+			p.pos = end
+			return keyword, true
+		}
+	}
+	return "", false
+}
+
+func unescapeWhitespace(r rune) rune {
+	switch r {
+	case 't':
+		return '\t'
+	case 'r':
+		return '\r'
+	case 'n':
+		return '\n'
+	}
+	return r
+}
+
+// escapeQueryString 转义 query_string 的保留字符
+func escapeQueryString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`+-=&|><!(){}[]^"~*?:\/ `, r) || unicode.IsSpace(r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// valueClause 生成单个值的查询条件，field 为空或 * 时在所有字段中查询
+func valueClause(field string, literal kqlLiteral) interface{} {
+	allFields := field == "" || field == "*"
+	if literal.wildcard && literal.text == "*" {
+		if allFields {
+			return map[string]interface{}{"match_all": map[string]interface{}{}}
+		}
+		return map[string]interface{}{"exists": map[string]string{"field": field}}
+	}
+	if literal.wildcard {
+		queryString := map[string]interface{}{"query": literal.pattern}
+		if !allFields {
+			queryString["fields"] = []string{field}
+		}
+		return map[string]interface{}{"query_string": queryString}
+	}
+
+	matchType := "best_fields"
+	if literal.quoted {
+		matchType = "phrase"
+	}
+	if allFields || strings.Contains(field, "*") {
+		multiMatch := map[string]interface{}{
+			"type":    matchType,
+			"query":   literal.text,
+			"lenient": true,
+		}
+		if !allFields {
+			multiMatch["fields"] = []string{field}
+		}
+		return map[string]interface{}{"multi_match": multiMatch}
+	}
+	if literal.quoted {
+		return map[string]interface{}{"match_phrase": map[string]string{field: literal.text}}
+	}
+	return map[string]interface{}{"match": map[string]string{field: literal.text}}
+}
@@ -0,0 +1,82 @@
+package connector
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseKQL(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", `{"match_all":{}}`},
+		{"response:200", `{"match":{"response":"200"}}`},
+		{`message:"connection refused"`, `{"match_phrase":{"message":"connection refused"}}`},
+		{"foo bar", `{"multi_match":{"lenient":true,"query":"foo bar","type":"best_fields"}}`},
+		{"user:*", `{"exists":{"field":"user"}}`},
+		{"response:200 or response:404", `{"bool":{"minimum_should_match":1,"should":[{"match":{"response":"200"}},{"match":{"response":"404"}}]}}`},
+		{"a:1 AND not b:2", `{"bool":{"filter":[{"match":{"a":"1"}},{"bool":{"must_not":{"match":{"b":"2"}}}}]}}`},
+		{"not(a:1)", `{"bool":{"must_not":{"match":{"a":"1"}}}}`},
+		{"status:(200 or 404)", `{"bool":{"minimum_should_match":1,"should":[{"match":{"status":"200"}},{"match":{"status":"404"}}]}}`},
+		{"bytes >= 100", `{"range":{"bytes":{"gte":"100"}}}`},
+		{`path:\and`, `{"match":{"path":"and"}}`},
+	}
+	for _, test := range tests {
+		got, err := ParseKQL(test.query)
+		if err != nil {
+			t.Errorf("ParseKQL(%q): %v", test.query, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("ParseKQL(%q) = %s, want %s", test.query, got, test.want)
+		}
+	}
+}
+
+func TestParseKQLKeywordPrefix(t *testing.T) {
+	// 以关键字开头的单词不是关键字
+	for _, query := range []string{"a:order", "a:1 and notice:2", "android", "a:1 or origin:x"} {
+		if _, err := ParseKQL(query); err != nil {
+			t.Errorf("ParseKQL(%q): %v", query, err)
+		}
+	}
+}
+
+func TestParseKQLDanglingOperator(t *testing.T) {
+	tests := []struct {
+		query    string
+		keyword  string
+		position int
+	}{
+		{"response:200 or", "or", 14},
+		{"foo and", "and", 5},
+		{"foo AND ", "and", 5},
+		{"not", "not", 1},
+		{"a:1 and not", "not", 9},
+		{"(a:1 or)", "or", 6},
+		{"status:(200 or)", "or", 13},
+		{"status:(not)", "not", 9},
+		{"user:{name:x and}", "and", 14},
+	}
+	for _, test := range tests {
+		got, err := ParseKQL(test.query)
+		if err == nil {
+			t.Errorf("ParseKQL(%q) = %s, want dangling operator error", test.query, got)
+			continue
+		}
+		want := "位置 " + strconv.Itoa(test.position) + "：运算符 " + test.keyword + " 之后缺少表达式"
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseKQL(%q) error = %q, want %q", test.query, err.Error(), want)
+		}
+	}
+}
+
+func TestParseKQLErrors(t *testing.T) {
+	for _, query := range []string{`message:"unclosed`, "(a:1", "a:", "a:1)", `a:1\`, "user:{name:x"} {
+		if got, err := ParseKQL(query); err == nil {
+			t.Errorf("ParseKQL(%q) = %s, want error", query, got)
+		}
+	}
+}
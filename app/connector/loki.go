@@ -0,0 +1,317 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"gin-zabbix/configs"
+	"io"
+	"net/http"
+	netUrl "net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Loki struct {
+	url      string
+	username string
+	password string
+	tenantID string
+	client   *http.Client
+	err      error
+}
+
+type lokiResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			// 指标查询返回 metric，日志查询返回 stream
+			Metric map[string]string `json:"metric"`
+			Stream map[string]string `json:"stream"`
+			// 指标查询为 [秒级时间戳, "值"]，日志查询为 ["纳秒时间戳", "日志"]
+			Values [][]json.RawMessage `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+func NewLoki(config configs.ElasticsearchConfig) *Loki {
+	tlsConfig, err := newTLSConfig(config)
+	tr := &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: tr,
+	}
+	return &Loki{
+		url:      strings.TrimSuffix(config.Url, "/"),
+		username: config.Username,
+		password: config.Password,
+		tenantID: config.TenantID,
+		client:   client,
+		err:      err,
+	}
+}
+
+// RequestApi 发送 GET 请求，返回响应体和 HTTP 状态码，非 2xx 状态码不视为错误，由调用方解析
+func (l *Loki) RequestApi(path string, params netUrl.Values) ([]byte, int, error) {
+	if l.err != nil {
+		return nil, 0, l.err
+	}
+	u := l.url + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("创建HTTP请求失败：%s", err.Error())
+	}
+	if l.username != "" {
+		req.SetBasicAuth(l.username, l.password)
+	}
+	if l.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", l.tenantID)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("发送HTTP请求失败：%s", err.Error())
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(resp.Body)
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取响应失败：%s", err.Error())
+	}
+
+	return responseBody, resp.StatusCode, nil
+}
+
+func (l *Loki) Ping() error {
+	responseBody, statusCode, err := l.RequestApi("/ready", nil)
+	if err != nil {
+		return fmt.Errorf("请求Loki失败：%s", err.Error())
+	}
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("Loki不可用：HTTP %d：%s", statusCode, strings.TrimSpace(string(responseBody)))
+	}
+	return nil
+}
+
+// QueryRange 调用 query_range 接口，Loki 的错误响应是纯文本
+func (l *Loki) QueryRange(params netUrl.Values) (lokiResponse, error) {
+	responseBody, statusCode, err := l.RequestApi(lokiQueryRangePath, params)
+	if err != nil {
+		return lokiResponse{}, fmt.Errorf("请求Loki失败：%s", err.Error())
+	}
+	if statusCode != http.StatusOK {
+		return lokiResponse{}, fmt.Errorf("查询失败：HTTP %d：%s", statusCode, strings.TrimSpace(string(responseBody)))
+	}
+	var response lokiResponse
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return lokiResponse{}, fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+	return response, nil
+}
+
+// lokiCountScript 取最后一个点的值，没有匹配的日志时 Loki 返回空结果，视为 0；
+// 监控项的 output_format 为 1，Zabbix 把响应包装为 {"header":…,"body":…}
+const lokiCountScript = `var result = JSON.parse(value).body.data.result;
+if (result.length === 0) {
+    return 0;
+}
+var values = result[0].values;
+return values[values.length - 1][1];`
+
+// lokiCountPattern 解析 LokiCountQuery 生成的查询，还原选择器、管道、统计窗口和入库延迟
+var lokiCountPattern = regexp.MustCompile(`^sum\(count_over_time\((\{(?:[^}"]|"(?:[^"\\]|\\.)*")*\})\s*(.*?)\s*\[(\w+)\](?: offset (\w+))?\)\)$`)
+
+// LogQL 由日志流选择器和管道（如 |= "error" | json）组成日志查询
+func LogQL(selector, pipeline string) string {
+	if pipeline == "" {
+		return selector
+	}
+	return selector + " " + pipeline
+}
+
+// LokiCountQuery 统计 [now-lag-window, now-lag] 内匹配的日志条数
+func LokiCountQuery(selector, pipeline, window, lag string) string {
+	query := fmt.Sprintf("sum(count_over_time(%s [%s]", LogQL(selector, pipeline), window)
+	if lag != "" {
+		query += " offset " + lag
+	}
+	return query + "))"
+}
+
+// ParseLokiCountQuery 返回选择器、管道、统计窗口和入库延迟，不是 LokiCountQuery 生成的查询时 ok 为 false
+func ParseLokiCountQuery(query string) (selector, pipeline, window, lag string, ok bool) {
+	match := lokiCountPattern.FindStringSubmatch(query)
+	if match == nil {
+		return "", "", "", "", false
+	}
+	return match[1], match[2], match[3], match[4], true
+}
+
+// LokiBackend 使用 query_range 接口执行 count_over_time，index 为日志流选择器，query_string 为管道
+type LokiBackend struct {
+	loki *Loki
+	url  string
+}
+
+func NewLokiBackend(config configs.ElasticsearchConfig) *LokiBackend {
+	loki := NewLoki(config)
+	return &LokiBackend{
+		loki: loki,
+		url:  loki.url,
+	}
+}
+
+func (b *LokiBackend) Name() string {
+	return BackendLoki
+}
+
+func (b *LokiBackend) Ping() error {
+	return b.loki.Ping()
+}
+
+// BuildRequest 按统计窗口设置 since 和 step，最后一个点即当前统计区间内的日志条数
+func (b *LokiBackend) BuildRequest(index string, query LogQuery) (LogRequest, error) {
+	if len(query.Query) > 0 {
+		return LogRequest{}, fmt.Errorf("Loki 不支持查询 DSL，请使用 query_string 指定 LogQL 管道")
+	}
+	if !strings.HasPrefix(index, "{") || !strings.HasSuffix(index, "}") {
+		return LogRequest{}, fmt.Errorf("Loki 的 index 必须是日志流选择器，如 {app=\"api\"}：%s", index)
+	}
+	return LogRequest{
+		Url: b.url + lokiQueryRangePath,
+		QueryFields: []map[string]string{
+			{"query": LokiCountQuery(index, query.QueryString, query.Window, query.Lag)},
+			{"since": query.Window},
+			{"step": query.Window},
+		},
+		Preprocessing: []map[string]string{javaScriptStep(lokiCountScript)},
+	}, nil
+}
+
+func (b *LokiBackend) params(request LogRequest) netUrl.Values {
+	params := netUrl.Values{}
+	for _, field := range request.QueryFields {
+		for name, value := range field {
+			params.Set(name, value)
+		}
+	}
+	return params
+}
+
+// Validate 执行一次查询，选择器或管道有语法错误时 Loki 返回 400
+func (b *LokiBackend) Validate(index string, request LogRequest) error {
+	_, err := b.count(request)
+	if err != nil {
+		return fmt.Errorf("查询语句无效：%s", err.Error())
+	}
+	return nil
+}
+
+func (b *LokiBackend) count(request LogRequest) (int64, error) {
+	response, err := b.loki.QueryRange(b.params(request))
+	if err != nil {
+		return 0, err
+	}
+	if len(response.Data.Result) == 0 || len(response.Data.Result[0].Values) == 0 {
+		return 0, nil
+	}
+	values := response.Data.Result[0].Values
+	point := values[len(values)-1]
+	if len(point) != 2 {
+		return 0, fmt.Errorf("解析响应失败：数据点格式不正确")
+	}
+	var value string
+	err = json.Unmarshal(point[1], &value)
+	if err != nil {
+		return 0, fmt.Errorf("解析命中数失败：%s", err.Error())
+	}
+	count, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("解析命中数失败：%s", err.Error())
+	}
+	return int64(count), nil
+}
+
+// Preview 返回统计区间内的日志条数和最新的日志，日志按时间倒序，
+// _index 为日志流的标签，_source 包含 timestamp 和 line
+func (b *LokiBackend) Preview(index string, request LogRequest, options PreviewOptions) (SearchResult, error) {
+	total, err := b.count(request)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	selector, pipeline, window, lag, ok := ParseLokiCountQuery(b.params(request).Get("query"))
+	if !ok || options.Size == 0 {
+		return SearchResult{Total: total, Hits: []SearchHit{}}, nil
+	}
+	windowDuration, err := ParseDuration(window)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	end := time.Now()
+	if lag != "" {
+		lagDuration, err := ParseDuration(lag)
+		if err != nil {
+			return SearchResult{}, err
+		}
+		end = end.Add(-lagDuration)
+	}
+	params := netUrl.Values{}
+	params.Set("query", LogQL(selector, pipeline))
+	params.Set("start", strconv.FormatInt(end.Add(-windowDuration).UnixNano(), 10))
+	params.Set("end", strconv.FormatInt(end.UnixNano(), 10))
+	params.Set("limit", strconv.Itoa(options.Size))
+	params.Set("direction", "backward")
+	response, err := b.loki.QueryRange(params)
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	hits := []SearchHit{}
+	for _, stream := range response.Data.Result {
+		labels := make([]string, 0, len(stream.Stream))
+		for name, value := range stream.Stream {
+			labels = append(labels, fmt.Sprintf("%s=%q", name, value))
+		}
+		sort.Strings(labels)
+		for _, value := range stream.Values {
+			var entry [2]string
+			if len(value) != 2 || json.Unmarshal(value[0], &entry[0]) != nil || json.Unmarshal(value[1], &entry[1]) != nil {
+				continue
+			}
+			nanos, err := strconv.ParseInt(entry[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			hits = append(hits, SearchHit{
+				Index: "{" + strings.Join(labels, ",") + "}",
+				ID:    entry[0],
+				Source: map[string]interface{}{
+					"timestamp": time.Unix(0, nanos).UTC().Format(time.RFC3339Nano),
+					"line":      entry[1],
+				},
+			})
+		}
+	}
+	// 多个日志流的结果各自有序，合并后按纳秒时间戳（位数相同）重新排序
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].ID > hits[j].ID
+	})
+	if len(hits) > options.Size {
+		hits = hits[:options.Size]
+	}
+	return SearchResult{Total: total, Hits: hits}, nil
+}
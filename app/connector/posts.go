@@ -0,0 +1,115 @@
+package connector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// searchBody 告警查询体，must 的第一个元素为查询条件，第二个元素为时间范围
+type searchBody struct {
+	Query struct {
+		Bool struct {
+			Must []json.RawMessage `json:"must"`
+		} `json:"bool"`
+	} `json:"query"`
+	Size           int   `json:"size"`
+	TrackTotalHits *bool `json:"track_total_hits,omitempty"`
+}
+
+type queryStringClause struct {
+	QueryString struct {
+		Query string `json:"query"`
+	} `json:"query_string"`
+}
+
+type rangeClause struct {
+	Range map[string]rangeQuery `json:"range"`
+}
+
+type rangeQuery struct {
+	Format string `json:"format"`
+	Gte    string `json:"gte"`
+	Lte    string `json:"lte"`
+}
+
+// marshal 与 json.Marshal 相同，但不转义 <、>、&，保持查询语句在 Zabbix 中可读
+func marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(v)
+	if err != nil {
+		return nil, fmt.Errorf("JSON编码失败：%s", err.Error())
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func parsePosts(posts string) (searchBody, error) {
+	var body searchBody
+	err := json.Unmarshal([]byte(posts), &body)
+	if err != nil {
+		return searchBody{}, fmt.Errorf("解析查询体失败：%s", err.Error())
+	}
+	return body, nil
+}
+
+// PostsOptions 查询体中除查询条件以外的部分
+type PostsOptions struct {
+	TimestampField string
+	Window         string
+	Lag            string
+	Flavor         Flavor
+}
+
+// GeneratePosts 统计时间字段在 [now-lag-window, now-lag] 区间内的日志数量，lag 为空时统计到当前时间
+func GeneratePosts(queryString string, options PostsOptions) (string, error) {
+	var clause queryStringClause
+	clause.QueryString.Query = queryString
+	query, err := marshal(clause)
+	if err != nil {
+		return "", err
+	}
+	return generatePosts(query, options)
+}
+
+// GenerateDSLPosts 与 GeneratePosts 相同，但使用任意查询 DSL 代替 query_string
+func GenerateDSLPosts(query json.RawMessage, options PostsOptions) (string, error) {
+	var buf bytes.Buffer
+	err := json.Compact(&buf, query)
+	if err != nil {
+		return "", fmt.Errorf("查询 DSL 不是合法的 JSON：%s", err.Error())
+	}
+	return generatePosts(buf.Bytes(), options)
+}
+
+func generatePosts(query json.RawMessage, options PostsOptions) (string, error) {
+	lte := "now"
+	if options.Lag != "" {
+		lte = fmt.Sprintf("now-%s", options.Lag)
+	}
+	timeRange, err := marshal(rangeClause{
+		Range: map[string]rangeQuery{
+			options.TimestampField: {
+				Format: "strict_date_optional_time",
+				Gte:    fmt.Sprintf("%s-%s", lte, options.Window),
+				Lte:    lte,
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var body searchBody
+	body.Query.Bool.Must = []json.RawMessage{query, timeRange}
+	if options.Flavor.TrackTotalHits() {
+		trackTotalHits := true
+		body.TrackTotalHits = &trackTotalHits
+	}
+	posts, err := marshal(body)
+	if err != nil {
+		return "", err
+	}
+	return string(posts), nil
+}
@@ -0,0 +1,140 @@
+package connector
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGeneratePostsRoundTrip(t *testing.T) {
+	queries := []string{
+		"*",
+		`message:"connection refused"`,
+		`path:C:\\logs\\app.log`,
+		"level:error\nAND service:api",
+		`status:<500 && user:"a&b"`,
+		`message:"say \"hi\""`,
+	}
+	for _, flavor := range []Flavor{Elasticsearch6, Elasticsearch7, OpenSearch2} {
+		for _, lag := range []string{"", "1m"} {
+			for _, query := range queries {
+				options := PostsOptions{TimestampField: "@timestamp", Window: "15m", Lag: lag, Flavor: flavor}
+				posts, err := GeneratePosts(query, options)
+				if err != nil {
+					t.Fatalf("GeneratePosts(%q): %v", query, err)
+				}
+				item := Item{Posts: posts}
+				if got := item.GetQueryString(); got != query {
+					t.Errorf("GetQueryString() = %q, want %q", got, query)
+				}
+				if item.IsDSL() {
+					t.Errorf("IsDSL() = true for query_string %q", query)
+				}
+				if got := item.GetWindow(); got != "15m" {
+					t.Errorf("GetWindow() = %q, want 15m", got)
+				}
+				if got := item.GetLag(); got != lag {
+					t.Errorf("GetLag() = %q, want %q", got, lag)
+				}
+				if got := item.GetTimestampField(); got != "@timestamp" {
+					t.Errorf("GetTimestampField() = %q, want @timestamp", got)
+				}
+			}
+		}
+	}
+}
+
+func TestGeneratePostsKeepsHTMLCharacters(t *testing.T) {
+	posts, err := GeneratePosts(`a<b && c>d`, PostsOptions{TimestampField: "ts", Window: "5m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(posts, `a<b && c>d`) {
+		t.Errorf("posts escaped <, > or &: %s", posts)
+	}
+}
+
+func TestGenerateDSLPostsRoundTrip(t *testing.T) {
+	query := json.RawMessage(`{
+		"bool": {
+			"filter": [
+				{"term": {"message": "line1\nline2 \"quoted\" C:\\tmp <&>"}}
+			]
+		}
+	}`)
+	posts, err := GenerateDSLPosts(query, PostsOptions{TimestampField: "event.created", Window: "1h", Lag: "2m", Flavor: Elasticsearch8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := Item{Posts: posts}
+	if !item.IsDSL() {
+		t.Error("IsDSL() = false for DSL query")
+	}
+	want := `{"bool":{"filter":[{"term":{"message":"line1\nline2 \"quoted\" C:\\tmp <&>"}}]}}`
+	if got := string(item.GetQuery()); got != want {
+		t.Errorf("GetQuery() = %s, want %s", got, want)
+	}
+	if got := item.GetQueryString(); got != want {
+		t.Errorf("GetQueryString() = %s, want %s", got, want)
+	}
+	if got := item.GetWindow(); got != "1h" {
+		t.Errorf("GetWindow() = %q, want 1h", got)
+	}
+	if got := item.GetLag(); got != "2m" {
+		t.Errorf("GetLag() = %q, want 2m", got)
+	}
+	if got := item.GetTimestampField(); got != "event.created" {
+		t.Errorf("GetTimestampField() = %q, want event.created", got)
+	}
+}
+
+func TestGenerateDSLPostsRejectsInvalidJSON(t *testing.T) {
+	_, err := GenerateDSLPosts(json.RawMessage(`{"match":`), PostsOptions{TimestampField: "ts", Window: "5m"})
+	if err == nil {
+		t.Error("GenerateDSLPosts accepted invalid JSON")
+	}
+}
+
+func TestTriggerExpression(t *testing.T) {
+	expression, err := TriggerExpression("default logs-app", "logs.error", ">=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "last(/default logs-app/logs.error,#3)>=10"; expression != want {
+		t.Errorf("TriggerExpression() = %q, want %q", expression, want)
+	}
+	for _, threshold := range []string{"<5", "<>0", "= 1.5", ">1K", `>{$LOGS_MAX}`, `>{$LOGS_MAX:"api"}`} {
+		if _, err := TriggerExpression("host", "key", threshold); err != nil {
+			t.Errorf("TriggerExpression threshold %q: %v", threshold, err)
+		}
+	}
+}
+
+func TestTriggerExpressionRejects(t *testing.T) {
+	tests := []struct {
+		name      string
+		host      string
+		key       string
+		threshold string
+	}{
+		{"host with slash", "logs/app", "key", ">1"},
+		{"host with comma", "logs,app", "key", ">1"},
+		{"host with quote", `logs"app`, "key", ">1"},
+		{"empty host", "", "key", ">1"},
+		{"key with brackets", "host", "key[1]", ">1"},
+		{"key with space", "host", "my key", ">1"},
+		{"key with slash", "host", "a/b", ">1"},
+		{"threshold without operator", "host", "key", "10"},
+		{"threshold with expression", "host", "key", ">1 or last(/h/k)>0"},
+		{"threshold with function", "host", "key", ">avg(/h/k,5m)"},
+		{"threshold with trailing text", "host", "key", ">10)"},
+		{"threshold with newline", "host", "key", ">1\n"},
+		{"empty threshold", "host", "key", ""},
+		{"lowercase macro", "host", "key", ">{$max}"},
+	}
+	for _, test := range tests {
+		if expression, err := TriggerExpression(test.host, test.key, test.threshold); err == nil {
+			t.Errorf("%s: TriggerExpression accepted %q", test.name, expression)
+		}
+	}
+}
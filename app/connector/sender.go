@@ -0,0 +1,141 @@
+package connector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Zabbix sender 协议：ZBXD 头、1 字节标志、4 字节数据长度和 4 字节保留字段（均为小端），后跟 JSON
+
+const senderFlagZabbix = 0x01
+
+type SenderValue struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock"`
+	NS    int    `json:"ns"`
+}
+
+// SenderResult trapper 处理结果，Zabbix 只返回每批的数量，不区分具体是哪个值失败
+type SenderResult struct {
+	Processed int    `json:"processed"`
+	Failed    int    `json:"failed"`
+	Total     int    `json:"total"`
+	Info      string `json:"info"`
+}
+
+type ZabbixSender struct {
+	address string
+	timeout time.Duration
+}
+
+// senderInfoPattern 解析响应中的 "processed: 1; failed: 0; total: 1; seconds spent: 0.000055"
+var senderInfoPattern = regexp.MustCompile(`processed: (\d+); failed: (\d+); total: (\d+)`)
+
+func NewZabbixSender(address string) *ZabbixSender {
+	return &ZabbixSender{
+		address: address,
+		timeout: 10 * time.Second,
+	}
+}
+
+func senderPacket(data []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("ZBXD")
+	buf.WriteByte(senderFlagZabbix)
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint32(header[:4], uint32(len(data)))
+	buf.Write(header)
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+// readSenderPacket 读取一个完整的响应包，返回其中的 JSON
+func readSenderPacket(r io.Reader) ([]byte, error) {
+	header := make([]byte, 13)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败：%s", err.Error())
+	}
+	if string(header[:4]) != "ZBXD" {
+		return nil, fmt.Errorf("响应不是 Zabbix 协议：%q", header[:4])
+	}
+	if header[4]&senderFlagZabbix == 0 {
+		return nil, fmt.Errorf("不支持的协议标志：%#x", header[4])
+	}
+	data := make([]byte, binary.LittleEndian.Uint32(header[5:9]))
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败：%s", err.Error())
+	}
+	return data, nil
+}
+
+// Send 发送一批值，Zabbix 拒绝整批请求时返回错误，部分值未被接受时由 Failed 体现
+func (s *ZabbixSender) Send(values []SenderValue) (SenderResult, error) {
+	now := time.Now()
+	request, err := json.Marshal(map[string]interface{}{
+		"request": "sender data",
+		"data":    values,
+		"clock":   now.Unix(),
+		"ns":      now.Nanosecond(),
+	})
+	if err != nil {
+		return SenderResult{}, fmt.Errorf("JSON编码失败：%s", err.Error())
+	}
+
+	conn, err := net.DialTimeout("tcp", s.address, s.timeout)
+	if err != nil {
+		return SenderResult{}, fmt.Errorf("连接Zabbix trapper失败：%s", err.Error())
+	}
+	// 推送在后台执行，关闭连接失败只记录日志
+	defer func(conn net.Conn) {
+		err := conn.Close()
+		if err != nil {
+			log.Printf("关闭Zabbix trapper连接失败：%s", err.Error())
+		}
+	}(conn)
+	err = conn.SetDeadline(now.Add(s.timeout))
+	if err != nil {
+		return SenderResult{}, fmt.Errorf("设置超时失败：%s", err.Error())
+	}
+
+	_, err = conn.Write(senderPacket(request))
+	if err != nil {
+		return SenderResult{}, fmt.Errorf("发送数据失败：%s", err.Error())
+	}
+	data, err := readSenderPacket(conn)
+	if err != nil {
+		return SenderResult{}, err
+	}
+
+	var response struct {
+		Response string `json:"response"`
+		Info     string `json:"info"`
+	}
+	err = json.Unmarshal(data, &response)
+	if err != nil {
+		return SenderResult{}, fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+	if response.Response != "success" {
+		return SenderResult{}, fmt.Errorf("Zabbix trapper 拒绝请求：%s", response.Info)
+	}
+
+	result := SenderResult{Info: response.Info}
+	match := senderInfoPattern.FindStringSubmatch(response.Info)
+	if match != nil {
+		result.Processed, _ = strconv.Atoi(match[1])
+		result.Failed, _ = strconv.Atoi(match[2])
+		result.Total, _ = strconv.Atoi(match[3])
+	}
+	return result, nil
+}
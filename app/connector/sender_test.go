@@ -0,0 +1,89 @@
+package connector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestSenderPacket(t *testing.T) {
+	data := []byte(`{"request":"sender data"}`)
+	packet := senderPacket(data)
+	if len(packet) != 13+len(data) {
+		t.Fatalf("len(packet) = %d, want %d", len(packet), 13+len(data))
+	}
+	if string(packet[:4]) != "ZBXD" {
+		t.Errorf("header = %q, want ZBXD", packet[:4])
+	}
+	if packet[4] != senderFlagZabbix {
+		t.Errorf("flag = %#x, want %#x", packet[4], senderFlagZabbix)
+	}
+	if length := binary.LittleEndian.Uint32(packet[5:9]); length != uint32(len(data)) {
+		t.Errorf("data length = %d, want %d", length, len(data))
+	}
+	if reserved := binary.LittleEndian.Uint32(packet[9:13]); reserved != 0 {
+		t.Errorf("reserved = %d, want 0", reserved)
+	}
+	if !bytes.Equal(packet[13:], data) {
+		t.Errorf("data = %q, want %q", packet[13:], data)
+	}
+}
+
+func TestReadSenderPacket(t *testing.T) {
+	data := []byte(`{"response":"success"}`)
+	got, err := readSenderPacket(bytes.NewReader(append(senderPacket(data), "trailing"...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("readSenderPacket() = %q, want %q", got, data)
+	}
+}
+
+func TestReadSenderPacketErrors(t *testing.T) {
+	valid := senderPacket([]byte(`{}`))
+	tests := []struct {
+		name   string
+		packet []byte
+	}{
+		{"empty", nil},
+		{"short header", valid[:10]},
+		{"wrong protocol", append([]byte("HTTP"), valid[4:]...)},
+		{"unsupported flag", append(append([]byte("ZBXD"), 0x00), valid[5:]...)},
+		{"truncated data", valid[:len(valid)-1]},
+	}
+	for _, test := range tests {
+		if data, err := readSenderPacket(bytes.NewReader(test.packet)); err == nil {
+			t.Errorf("%s: readSenderPacket accepted %q", test.name, data)
+		}
+	}
+}
+
+func TestZabbixSenderSend(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err := readSenderPacket(conn); err != nil {
+			return
+		}
+		conn.Write(senderPacket([]byte(`{"response":"success","info":"processed: 1; failed: 1; total: 2; seconds spent: 0.000055"}`)))
+	}()
+
+	sender := NewZabbixSender(listener.Addr().String())
+	result, err := sender.Send([]SenderValue{{Host: "h", Key: "a", Value: "1"}, {Host: "h", Key: "b", Value: "x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Processed != 1 || result.Failed != 1 || result.Total != 2 {
+		t.Errorf("Send() = %+v, want processed 1, failed 1, total 2", result)
+	}
+}
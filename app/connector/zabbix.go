@@ -2,12 +2,18 @@ package connector
 
 import (
 	"bytes"
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"gin-zabbix/configs"
 	"io"
 	"net/http"
 	netUrl "net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Zabbix struct {
@@ -21,9 +27,9 @@ type ResponseError struct {
 	Data    string `json:"data"`
 }
 
-func GeneratePosts(queryString, delay string) string {
-	posts := fmt.Sprintf(`{"query":{"bool":{"must":[{"query_string":{"query":"%s"}},{"range":{"@timestamp":{"format":"strict_date_optional_time","gte":"now-%s","lte":"now"}}}]}},"size":0}`, queryString, delay)
-	return posts
+type Tag struct {
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
 }
 
 type Item struct {
@@ -35,32 +41,212 @@ type Item struct {
 	Url         string `json:"url"`
 	Posts       string `json:"posts"`
 	Description string `json:"description"`
+	Tags        []Tag  `json:"tags"`
+	// 0 为启用，1 为停用
+	Status string `json:"status"`
+	// Loki 监控项的查询参数
+	QueryFields []map[string]string `json:"query_fields"`
+	// 引用该监控项的触发器，查询时指定 selectTriggers 才有
+	Triggers []Trigger `json:"triggers,omitempty"`
 }
 
+// alertItemTriggerFields 查询监控项时一并返回的触发器字段，避免逐个监控项查询触发器
+var alertItemTriggerFields = []string{"triggerid", "description", "expression", "status", "value"}
+
+// AlertTrigger 返回监控项自身的告警触发器，即与监控项同名的触发器
+func (i *Item) AlertTrigger() (Trigger, bool) {
+	for _, trigger := range i.Triggers {
+		if trigger.Description == i.Name {
+			return trigger, true
+		}
+	}
+	return Trigger{}, false
+}
+
+// GetTag 返回指定标签的值，不存在时返回空字符串
+func (i *Item) GetTag(tag string) string {
+	for _, t := range i.Tags {
+		if t.Tag == tag {
+			return t.Value
+		}
+	}
+	return ""
+}
+
+// lokiQueryRangePath Loki 监控项请求的接口
+const lokiQueryRangePath = "/loki/api/v1/query_range"
+
+// IsLoki 监控项是否统计 Loki 日志，触发器中引用的监控项没有标签，按 URL 判断
+func (i *Item) IsLoki() bool {
+	return i.GetTag(BackendTag) == BackendLoki || strings.HasSuffix(i.Url, lokiQueryRangePath)
+}
+
+// lokiQuery 解析 Loki 监控项的 count_over_time 查询
+func (i *Item) lokiQuery() (selector, pipeline, window, lag string) {
+	for _, field := range i.QueryFields {
+		if query, ok := field["query"]; ok {
+			selector, pipeline, window, lag, _ = ParseLokiCountQuery(query)
+			return
+		}
+	}
+	return
+}
+
+// GetQuery 返回查询体中的查询条件，即 must 的第一个元素
+func (i *Item) GetQuery() json.RawMessage {
+	body, err := parsePosts(i.Posts)
+	if err != nil || len(body.Query.Bool.Must) == 0 {
+		return nil
+	}
+	return body.Query.Bool.Must[0]
+}
+
+// IsDSL 查询条件不是 query_string 时视为使用查询 DSL 创建
+func (i *Item) IsDSL() bool {
+	var clause struct {
+		QueryString *struct{} `json:"query_string"`
+	}
+	err := json.Unmarshal(i.GetQuery(), &clause)
+	return err == nil && clause.QueryString == nil
+}
+
+// GetQueryString 返回 query_string 的值，使用查询 DSL 创建的告警返回 DSL 本身
 func (i *Item) GetQueryString() string {
-	s := i.Posts
-	var data map[string]interface{}
-	err := json.Unmarshal([]byte(s), &data)
-	if err != nil {
+	if i.IsLoki() {
+		_, pipeline, _, _ := i.lokiQuery()
+		return pipeline
+	}
+	query := i.GetQuery()
+	if query == nil {
 		return "无法解析 JSON"
 	}
 
-	queryString, ok := data["query"].(map[string]interface{})["bool"].(map[string]interface{})["must"].([]interface{})[0].(map[string]interface{})["query_string"].(map[string]interface{})["query"].(string)
-	if !ok {
-		return "无法找到 query_string 的值"
+	var clause struct {
+		QueryString *struct {
+			Query string `json:"query"`
+		} `json:"query_string"`
+	}
+	err := json.Unmarshal(query, &clause)
+	if err != nil || clause.QueryString == nil {
+		return string(query)
+	}
+	return clause.QueryString.Query
+}
+
+// getRange 解析查询体中的时间字段以及时间范围的 gte 和 lte
+func (i *Item) getRange() (string, string, string) {
+	body, err := parsePosts(i.Posts)
+	if err != nil {
+		return "", "", ""
+	}
+	for _, clause := range body.Query.Bool.Must {
+		var r rangeClause
+		err := json.Unmarshal(clause, &r)
+		if err != nil {
+			continue
+		}
+		for field, value := range r.Range {
+			return field, value.Gte, value.Lte
+		}
+	}
+	return "", "", ""
+}
+
+// GetTimestampField 返回时间范围所使用的字段
+func (i *Item) GetTimestampField() string {
+	field, _, _ := i.getRange()
+	return field
+}
+
+// GetRange 返回查询体时间范围的 gte 和 lte，如 now-1m-15m 和 now-1m
+func (i *Item) GetRange() (string, string) {
+	_, gte, lte := i.getRange()
+	return gte, lte
+}
+
+// GetWindow 从查询体还原统计窗口，如 gte 为 now-1m-15m、lte 为 now-1m 时返回 15m
+func (i *Item) GetWindow() string {
+	if i.IsLoki() {
+		_, _, window, _ := i.lokiQuery()
+		return window
+	}
+	_, gte, lte := i.getRange()
+	return strings.TrimPrefix(gte, lte+"-")
+}
+
+// GetLag 从查询体还原入库延迟，lte 为 now 时返回空字符串
+func (i *Item) GetLag() string {
+	if i.IsLoki() {
+		_, _, _, lag := i.lokiQuery()
+		return lag
 	}
-	return queryString
+	_, _, lte := i.getRange()
+	return strings.TrimPrefix(strings.TrimPrefix(lte, "now"), "-")
 }
 
+// GetIndex 返回 URL 中的索引名，Loki 监控项返回日志流选择器
 func (i *Item) GetIndex() string {
+	if i.IsLoki() {
+		selector, _, _, _ := i.lokiQuery()
+		return selector
+	}
 	s := i.Url
 	// Find the last index of "/"
 	lastSlashIndex := strings.LastIndex(i.Url, "/")
+	// trapper 监控项没有 URL
+	if lastSlashIndex < 0 {
+		return ""
+	}
 	// Find the second last index of "/"
 	secondLastSlashIndex := strings.LastIndex(s[:lastSlashIndex], "/")
 	// Extract the substring between the second last and last slash
 	index := s[secondLastSlashIndex+1 : lastSlashIndex]
-	return index
+	// 日期运算等索引名在 URL 中经过转义
+	unescaped, err := netUrl.PathUnescape(index)
+	if err != nil {
+		return index
+	}
+	return unescaped
+}
+
+// HostName 由索引名生成主机名：去掉通配符和日期运算部分，
+// 其余 Zabbix 主机名不支持的字符（如跨集群搜索的 ":"）替换为 "_"，
+// Loki 的日志流选择器去掉花括号、引号和空格。有字符被去掉或替换时加上原索引名 MD5 的前 8 位，
+// 避免 logs-* 与 <logs-{now/d}>、不同的中文索引名等对应同一主机，如 logs-* 为 logs-_c0aaf2a6
+func HostName(index string) string {
+	name := LegacyHostName(index)
+	if name == index {
+		return name
+	}
+	hash := md5.Sum([]byte(index))
+	return name + "_" + hex.EncodeToString(hash[:4])
+}
+
+// LegacyHostName 之前版本的主机名，不同的索引可能对应同一主机，只用于查找之前创建的主机，
+// 如 {app="api", env="prod"} 为 app_api_env_prod
+func LegacyHostName(index string) string {
+	if strings.HasPrefix(index, "{") && strings.HasSuffix(index, "}") {
+		index = strings.NewReplacer(`"`, "", " ", "").Replace(strings.Trim(index, "{}"))
+	}
+	var b strings.Builder
+	depth := 0
+	for _, r := range index {
+		switch {
+		case r == '{':
+			depth++
+		case r == '}':
+			if depth > 0 {
+				depth--
+			}
+		case depth > 0, r == '*', r == '<', r == '>':
+		case r < 128 && (r == '_' || r == '.' || r == ' ' || r == '-' ||
+			'0' <= r && r <= '9' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z'):
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
 }
 
 func (i *Item) GetElasticsearch() string {
@@ -68,7 +254,7 @@ func (i *Item) GetElasticsearch() string {
 	if err != nil {
 		return "无法解析 URL"
 	}
-	elasticsearch := fmt.Sprintf("%s//%s", u.Scheme, u.Host)
+	elasticsearch := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
 	return elasticsearch
 }
 
@@ -76,6 +262,12 @@ type Trigger struct {
 	TriggerID   string `json:"triggerid"`
 	Expression  string `json:"expression"`
 	Description string `json:"description"`
+	Comments    string `json:"comments"`
+	Items       []Item `json:"items"`
+	// 0 为启用，1 为停用
+	Status string `json:"status"`
+	// 0 为正常，1 为问题
+	Value string `json:"value"`
 }
 
 func (t *Trigger) GetThreshold() string {
@@ -89,6 +281,28 @@ func (t *Trigger) GetThreshold() string {
 	return threshold
 }
 
+type Trend struct {
+	Clock    string `json:"clock"`
+	Num      string `json:"num"`
+	ValueMin string `json:"value_min"`
+	ValueAvg string `json:"value_avg"`
+	ValueMax string `json:"value_max"`
+}
+
+type UserMacro struct {
+	HostMacroID string `json:"hostmacroid"`
+	HostID      string `json:"hostid"`
+	Macro       string `json:"macro"`
+	Value       string `json:"value"`
+}
+
+type Problem struct {
+	EventID  string `json:"eventid"`
+	ObjectID string `json:"objectid"`
+	Name     string `json:"name"`
+	Clock    string `json:"clock"`
+}
+
 type Host struct {
 	HostID string `json:"hostid"`
 	Host   string `json:"host"`
@@ -140,41 +354,108 @@ func (z *Zabbix) RequestApi(payload map[string]interface{}) ([]byte, error) {
 	return responseBody, nil
 }
 
-func (z *Zabbix) CreateItem(name, key, hostid, delay, username, password, url, posts, description string) (string, error) {
+// httpAgentAuth 按集群配置设置 HTTP agent 监控项的认证方式、租户和 TLS 校验
+func httpAgentAuth(params map[string]interface{}, es configs.ElasticsearchConfig) {
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+	if es.ApiKey != "" {
+		params["authtype"] = 0
+		headers["Authorization"] = fmt.Sprintf("ApiKey %s", es.ApiKey)
+	} else {
+		params["authtype"] = 1
+		params["username"] = es.Username
+		params["password"] = es.Password
+	}
+	if es.TenantID != "" {
+		headers["X-Scope-OrgID"] = es.TenantID
+	}
+	params["headers"] = headers
+
+	verifyPeer, verifyHost := 0, 0
+	if es.VerifyPeer {
+		verifyPeer = 1
+	}
+	if es.VerifyHost {
+		verifyHost = 1
+	}
+	params["verify_peer"] = verifyPeer
+	params["verify_host"] = verifyHost
+	params["ssl_cert_file"] = es.SslCertFile
+	params["ssl_key_file"] = es.SslKeyFile
+}
+
+// CreateItem 按日志后端生成的请求创建 HTTP agent 监控项
+func (z *Zabbix) CreateItem(name, key, hostid, delay string, es configs.ElasticsearchConfig, request LogRequest, description string, tags []Tag) (string, error) {
+	itemTags := []Tag{{Tag: "logs", Value: "alert"}}
+	itemTags = append(itemTags, tags...)
+
+	params := map[string]interface{}{
+		"type":           19,
+		"name":           name,
+		"key_":           key,
+		"hostid":         hostid,
+		"delay":          delay,
+		"value_type":     3,
+		"output_format":  1,
+		"timeout":        "30s",
+		"url":            request.Url,
+		"posts":          request.Posts,
+		"post_type":      2,
+		"request_method": 0,
+		"preprocessing":  request.Preprocessing,
+		"tags":           itemTags,
+		"description":    description,
+	}
+	if len(request.QueryFields) > 0 {
+		params["query_fields"] = request.QueryFields
+	}
+	httpAgentAuth(params, es)
+
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "item.create",
+		"params":  params,
+		"id":      1,
+		"auth":    z.token,
+	}
+
+	responseBody, err := z.RequestApi(payload)
+	if err != nil {
+		return "", fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+	}
+
+	var response struct {
+		Error  ResponseError       `json:"error"`
+		Result map[string][]string `json:"result"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return "", fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Error.Message != "" {
+		return "", fmt.Errorf("创建监控项失败：%s", response.Error.Data)
+	}
+
+	return response.Result["itemids"][0], nil
+}
+
+// CreateTrapperItem 创建 trapper 监控项，由本服务执行查询后通过 sender 协议推送命中数
+func (z *Zabbix) CreateTrapperItem(name, key, hostid, description string, tags []Tag) (string, error) {
+	itemTags := []Tag{{Tag: "logs", Value: "alert"}}
+	itemTags = append(itemTags, tags...)
 
 	payload := map[string]interface{}{
 		"jsonrpc": "2.0",
 		"method":  "item.create",
 		"params": map[string]interface{}{
-			"type":           19,
-			"name":           name,
-			"key_":           key,
-			"hostid":         hostid,
-			"delay":          delay,
-			"value_type":     3,
-			"output_format":  1,
-			"authtype":       1,
-			"username":       username,
-			"password":       password,
-			"timeout":        "30s",
-			"url":            url,
-			"posts":          posts,
-			"post_type":      2,
-			"request_method": 0,
-			"headers": map[string]string{
-				"Content-Type": "application/json",
-			},
-			"preprocessing": []map[string]string{
-				{
-					"type":                 "12",
-					"params":               "$.body.hits.total.value",
-					"error_handler":        "0",
-					"error_handler_params": "",
-				},
-			},
-			"tags": []map[string]string{
-				{"tag": "logs", "value": "alert"},
-			},
+			"type":        2,
+			"name":        name,
+			"key_":        key,
+			"hostid":      hostid,
+			"value_type":  3,
+			"tags":        itemTags,
 			"description": description,
 		},
 		"id":   1,
@@ -202,6 +483,118 @@ func (z *Zabbix) CreateItem(name, key, hostid, delay, username, password, url, p
 	return response.Result["itemids"][0], nil
 }
 
+// UpdateItem 按新的请求修改 HTTP agent 监控项，名称和 key 不变
+func (z *Zabbix) UpdateItem(itemID, delay string, es configs.ElasticsearchConfig, request LogRequest, description string, tags []Tag) error {
+	itemTags := []Tag{{Tag: "logs", Value: "alert"}}
+	itemTags = append(itemTags, tags...)
+
+	params := map[string]interface{}{
+		"itemid":        itemID,
+		"delay":         delay,
+		"url":           request.Url,
+		"posts":         request.Posts,
+		"preprocessing": request.Preprocessing,
+		"tags":          itemTags,
+		"description":   description,
+	}
+	if len(request.QueryFields) > 0 {
+		params["query_fields"] = request.QueryFields
+	}
+	httpAgentAuth(params, es)
+
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "item.update",
+		"params":  params,
+		"id":      1,
+		"auth":    z.token,
+	}
+	return z.updateItem(payload)
+}
+
+// UpdateTrapperItem 修改 trapper 监控项的描述和标签，查询保存在本服务中
+func (z *Zabbix) UpdateTrapperItem(itemID, description string, tags []Tag) error {
+	itemTags := []Tag{{Tag: "logs", Value: "alert"}}
+	itemTags = append(itemTags, tags...)
+
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "item.update",
+		"params": map[string]interface{}{
+			"itemid":      itemID,
+			"tags":        itemTags,
+			"description": description,
+		},
+		"id":   1,
+		"auth": z.token,
+	}
+	return z.updateItem(payload)
+}
+
+func (z *Zabbix) updateItem(payload map[string]interface{}) error {
+	responseBody, err := z.RequestApi(payload)
+	if err != nil {
+		return fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+	}
+
+	var response struct {
+		Error  ResponseError       `json:"error"`
+		Result map[string][]string `json:"result"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Error.Message != "" {
+		return fmt.Errorf("修改监控项失败：%s", response.Error.Data)
+	}
+
+	return nil
+}
+
+// GetItemByID 按 ID 获取告警监控项，不存在时返回空的 Item
+func (z *Zabbix) GetItemByID(itemID string) (Item, error) {
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "item.get",
+		"params": map[string]interface{}{
+			"itemids": itemID,
+			"tags": []map[string]string{
+				{"tag": "logs", "operator": "4"},
+			},
+			"selectTags":     "extend",
+			"selectTriggers": alertItemTriggerFields,
+		},
+		"id":   1,
+		"auth": z.token,
+	}
+
+	responseBody, err := z.RequestApi(payload)
+	if err != nil {
+		return Item{}, fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+	}
+
+	var response struct {
+		Error  ResponseError `json:"error"`
+		Result []Item        `json:"result"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return Item{}, fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Error.Message != "" {
+		return Item{}, fmt.Errorf("获取监控项失败：%s", response.Error.Data)
+	}
+
+	if len(response.Result) > 0 {
+		return response.Result[0], nil
+	}
+
+	return Item{}, nil
+}
+
 func (z *Zabbix) GetItemByName(itemName, hostid string) (Item, error) {
 	payload := map[string]interface{}{
 		"jsonrpc": "2.0",
@@ -214,6 +607,7 @@ func (z *Zabbix) GetItemByName(itemName, hostid string) (Item, error) {
 			"tags": []map[string]string{
 				{"tag": "logs", "operator": "4"},
 			},
+			"selectTags": "extend",
 		},
 		"id":   1,
 		"auth": z.token,
@@ -253,6 +647,8 @@ func (z *Zabbix) GetItems() ([]Item, error) {
 			"tags": []map[string]string{
 				{"tag": "logs", "operator": "4"},
 			},
+			"selectTags":     "extend",
+			"selectTriggers": alertItemTriggerFields,
 		},
 		"id":   1,
 		"auth": z.token,
@@ -289,6 +685,8 @@ func (z *Zabbix) GetItemsByHost(hostid string) ([]Item, error) {
 			"tags": []map[string]string{
 				{"tag": "logs", "operator": "4"},
 			},
+			"selectTags":     "extend",
+			"selectTriggers": alertItemTriggerFields,
 		},
 		"id":   1,
 		"auth": z.token,
@@ -316,6 +714,43 @@ func (z *Zabbix) GetItemsByHost(hostid string) ([]Item, error) {
 
 }
 
+// GetItemsByTag 获取带有指定标签的日志告警监控项
+func (z *Zabbix) GetItemsByTag(tag string) ([]Item, error) {
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "item.get",
+		"params": map[string]interface{}{
+			"tags": []map[string]string{
+				{"tag": "logs", "operator": "4"},
+				{"tag": tag, "operator": "4"},
+			},
+			"selectTags": "extend",
+		},
+		"id":   1,
+		"auth": z.token,
+	}
+
+	responseBody, err := z.RequestApi(payload)
+	if err != nil {
+		return []Item{}, fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+	}
+
+	var response struct {
+		Error  ResponseError `json:"error"`
+		Result []Item        `json:"result"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return []Item{}, fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Error.Message != "" {
+		return []Item{}, fmt.Errorf("获取监控项失败：%s", response.Error.Data)
+	}
+
+	return response.Result, nil
+}
+
 func (z *Zabbix) DeleteItemByID(itemId string) (string, error) {
 	payload := map[string]interface{}{
 		"jsonrpc": "2.0",
@@ -425,20 +860,81 @@ func (z *Zabbix) GetHostByName(hostName string) (Host, error) {
 	return Host{}, nil
 }
 
-func (z *Zabbix) CreateTrigger(hostName, itemName, itemKey, threshold string) (string, error) {
+var (
+	// Zabbix 主机名允许的字符
+	hostNamePattern = regexp.MustCompile(`^[0-9A-Za-z_. \-]+$`)
+	// 不带参数的监控项 key
+	itemKeyPattern = regexp.MustCompile(`^[0-9A-Za-z_.\-]+$`)
+	// 比较运算符之后只允许数字（可带单位后缀）或用户宏
+	thresholdPattern = regexp.MustCompile(`^(>=|<=|<>|>|<|=)\s*(-?[0-9]+(\.[0-9]+)?[KMGTsmhdw]?|\{\$[A-Z0-9_.]+(:"([^"\\]|\\.)*")?\})$`)
+)
+
+// TriggerExpression 生成 last(/host/key,#3)<threshold>，
+// 主机名、key 或阈值会改变表达式结构时返回错误，而不是拼接出非预期的表达式
+func TriggerExpression(hostName, itemKey, threshold string) (string, error) {
+	if !hostNamePattern.MatchString(hostName) {
+		return "", fmt.Errorf("主机名包含触发器表达式不支持的字符：%s", hostName)
+	}
+	if !itemKeyPattern.MatchString(itemKey) {
+		return "", fmt.Errorf("监控项 key 包含触发器表达式不支持的字符：%s", itemKey)
+	}
+	if !thresholdPattern.MatchString(threshold) {
+		return "", fmt.Errorf("阈值必须是比较运算符加数字或宏：%s", threshold)
+	}
+	return fmt.Sprintf("last(/%s/%s,#3)%s", hostName, itemKey, threshold), nil
+}
+
+// ParseDuration 解析检查周期、统计窗口和入库延迟，即 Zabbix、Elasticsearch 日期运算和 LogQL 共同支持的
+// 15m、1d 等写法，纯数字按 Zabbix 的规则视为秒
+func ParseDuration(s string) (time.Duration, error) {
+	unit := map[byte]time.Duration{
+		's': time.Second,
+		'm': time.Minute,
+		'h': time.Hour,
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+	}
+	number := s
+	if s != "" && unit[s[len(s)-1]] != 0 {
+		number = s[:len(s)-1]
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n <= 0 || strings.HasPrefix(number, "+") {
+		return 0, fmt.Errorf("无法解析时间长度：%s", s)
+	}
+	if number == s {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.Duration(n) * unit[s[len(s)-1]], nil
+}
+
+// CreateTrigger 创建告警触发器，url 不为空时作为触发器的链接，comments 不为空时作为触发器的说明
+func (z *Zabbix) CreateTrigger(hostName, itemName, itemKey, threshold, url, comments string) (string, error) {
+	expression, err := TriggerExpression(hostName, itemKey, threshold)
+	if err != nil {
+		return "", err
+	}
+
+	params := map[string]interface{}{
+		"expression":  expression,
+		"description": itemName,
+		"priority":    "5",
+		"tags": []map[string]string{
+			{"tag": "logs", "value": "alert"},
+		},
+	}
+	if url != "" {
+		params["url"] = url
+	}
+	if comments != "" {
+		params["comments"] = comments
+	}
 	payload := map[string]interface{}{
 		"jsonrpc": "2.0",
 		"method":  "trigger.create",
-		"params": map[string]interface{}{
-			"expression":  fmt.Sprintf("last(/%s/%s,#3)%s", hostName, itemKey, threshold),
-			"description": itemName,
-			"priority":    "5",
-			"tags": []map[string]string{
-				{"tag": "logs", "value": "alert"},
-			},
-		},
-		"id":   1,
-		"auth": z.token,
+		"params":  params,
+		"id":      1,
+		"auth":    z.token,
 	}
 
 	responseBody, err := z.RequestApi(payload)
@@ -462,17 +958,21 @@ func (z *Zabbix) CreateTrigger(hostName, itemName, itemKey, threshold string) (s
 	return response.Result["triggerids"][0], nil
 }
 
-func (z *Zabbix) GetTriggerByName(triggerName string) (Trigger, error) {
+// UpdateTrigger 修改告警触发器的阈值、链接和说明
+func (z *Zabbix) UpdateTrigger(triggerID, hostName, itemKey, threshold, url, comments string) error {
+	expression, err := TriggerExpression(hostName, itemKey, threshold)
+	if err != nil {
+		return err
+	}
+
 	payload := map[string]interface{}{
 		"jsonrpc": "2.0",
-		"method":  "trigger.get",
+		"method":  "trigger.update",
 		"params": map[string]interface{}{
-			"filter": map[string]interface{}{
-				"description": []string{triggerName},
-			},
-			"tags": []map[string]string{
-				{"tag": "logs", "operator": "4"},
-			},
+			"triggerid":  triggerID,
+			"expression": expression,
+			"url":        url,
+			"comments":   comments,
 		},
 		"id":   1,
 		"auth": z.token,
@@ -480,13 +980,166 @@ func (z *Zabbix) GetTriggerByName(triggerName string) (Trigger, error) {
 
 	responseBody, err := z.RequestApi(payload)
 	if err != nil {
-		return Trigger{}, fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+		return fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
 	}
 
 	var response struct {
-		Error  ResponseError `json:"error"`
-		Result []Trigger     `json:"result"`
-	}
+		Error  ResponseError       `json:"error"`
+		Result map[string][]string `json:"result"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Error.Message != "" {
+		return fmt.Errorf("修改触发器失败：%s", response.Error.Data)
+	}
+
+	return nil
+}
+
+// CreateCompositeTrigger 创建引用多个监控项的组合触发器，expression 由调用方拼接
+func (z *Zabbix) CreateCompositeTrigger(name, expression, comments string) (string, error) {
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "trigger.create",
+		"params": map[string]interface{}{
+			"expression":  expression,
+			"description": name,
+			"comments":    comments,
+			"priority":    "5",
+			"tags": []map[string]string{
+				{"tag": "logs", "value": "composite"},
+			},
+		},
+		"id":   1,
+		"auth": z.token,
+	}
+
+	responseBody, err := z.RequestApi(payload)
+	if err != nil {
+		return "", fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+	}
+
+	var response struct {
+		Error  ResponseError       `json:"error"`
+		Result map[string][]string `json:"result"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return "", fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Error.Message != "" {
+		return "", fmt.Errorf("创建组合触发器失败：%s", response.Error.Data)
+	}
+
+	return response.Result["triggerids"][0], nil
+}
+
+// GetCompositeTriggers 获取组合触发器及其引用的监控项，itemIDs 为空时返回全部
+func (z *Zabbix) GetCompositeTriggers(itemIDs []string) ([]Trigger, error) {
+	params := map[string]interface{}{
+		"output":           []string{"triggerid", "description", "comments", "expression"},
+		"expandExpression": true,
+		"selectItems":      []string{"itemid", "hostid", "name", "key_", "url", "query_fields"},
+		"evaltype":         0,
+		"tags": []map[string]string{
+			{"tag": "logs", "value": "composite", "operator": "1"},
+		},
+	}
+	if len(itemIDs) > 0 {
+		params["itemids"] = itemIDs
+	}
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "trigger.get",
+		"params":  params,
+		"id":      1,
+		"auth":    z.token,
+	}
+
+	responseBody, err := z.RequestApi(payload)
+	if err != nil {
+		return []Trigger{}, fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+	}
+
+	var response struct {
+		Error  ResponseError `json:"error"`
+		Result []Trigger     `json:"result"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return []Trigger{}, fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Error.Message != "" {
+		return []Trigger{}, fmt.Errorf("获取组合触发器失败：%s", response.Error.Data)
+	}
+
+	return response.Result, nil
+}
+
+func (z *Zabbix) DeleteTriggerByID(triggerID string) (string, error) {
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "trigger.delete",
+		"params":  []string{triggerID},
+		"id":      1,
+		"auth":    z.token,
+	}
+
+	responseBody, err := z.RequestApi(payload)
+	if err != nil {
+		return "", fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+	}
+
+	var response struct {
+		Error  ResponseError       `json:"error"`
+		Result map[string][]string `json:"result"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return "", fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Error.Message != "" {
+		return "", fmt.Errorf("删除触发器失败：%s", response.Error.Data)
+	}
+
+	if len(response.Result["triggerids"]) > 0 {
+		return response.Result["triggerids"][0], nil
+	}
+
+	return "", fmt.Errorf("触发器不存在：%s", triggerID)
+}
+
+func (z *Zabbix) GetTriggerByName(triggerName string) (Trigger, error) {
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "trigger.get",
+		"params": map[string]interface{}{
+			"filter": map[string]interface{}{
+				"description": []string{triggerName},
+			},
+			"tags": []map[string]string{
+				{"tag": "logs", "operator": "4"},
+			},
+		},
+		"id":   1,
+		"auth": z.token,
+	}
+
+	responseBody, err := z.RequestApi(payload)
+	if err != nil {
+		return Trigger{}, fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+	}
+
+	var response struct {
+		Error  ResponseError `json:"error"`
+		Result []Trigger     `json:"result"`
+	}
 	err = json.Unmarshal(responseBody, &response)
 	if err != nil {
 		return Trigger{}, fmt.Errorf("解析响应失败：%s", err.Error())
@@ -504,6 +1157,47 @@ func (z *Zabbix) GetTriggerByName(triggerName string) (Trigger, error) {
 
 }
 
+// GetAlertTrigger 获取监控项自身的告警触发器，不包括引用它的组合触发器
+func (z *Zabbix) GetAlertTrigger(itemID string) (Trigger, error) {
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "trigger.get",
+		"params": map[string]interface{}{
+			"output":  []string{"triggerid", "description", "expression"},
+			"itemids": itemID,
+			"tags": []map[string]string{
+				{"tag": "logs", "value": "alert", "operator": "1"},
+			},
+		},
+		"id":   1,
+		"auth": z.token,
+	}
+
+	responseBody, err := z.RequestApi(payload)
+	if err != nil {
+		return Trigger{}, fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+	}
+
+	var response struct {
+		Error  ResponseError `json:"error"`
+		Result []Trigger     `json:"result"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return Trigger{}, fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Error.Message != "" {
+		return Trigger{}, fmt.Errorf("获取触发器失败：%s", response.Error.Data)
+	}
+
+	if len(response.Result) > 0 {
+		return response.Result[0], nil
+	}
+
+	return Trigger{}, fmt.Errorf("监控项没有告警触发器：%s", itemID)
+}
+
 func (z *Zabbix) GetTriggerByID(triggerID string) (Trigger, error) {
 	payload := map[string]interface{}{
 		"jsonrpc": "2.0",
@@ -538,3 +1232,294 @@ func (z *Zabbix) GetTriggerByID(triggerID string) (Trigger, error) {
 
 	return Trigger{}, fmt.Errorf("触发器不存在：%s", triggerID)
 }
+
+// GetTrends 获取监控项在 [timeFrom, timeTill] 内的小时趋势数据
+func (z *Zabbix) GetTrends(itemID string, timeFrom, timeTill int64) ([]Trend, error) {
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "trend.get",
+		"params": map[string]interface{}{
+			"itemids":   itemID,
+			"time_from": timeFrom,
+			"time_till": timeTill,
+			"output":    []string{"clock", "num", "value_min", "value_avg", "value_max"},
+		},
+		"id":   1,
+		"auth": z.token,
+	}
+
+	responseBody, err := z.RequestApi(payload)
+	if err != nil {
+		return []Trend{}, fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+	}
+
+	var response struct {
+		Error  ResponseError `json:"error"`
+		Result []Trend       `json:"result"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return []Trend{}, fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Error.Message != "" {
+		return []Trend{}, fmt.Errorf("获取趋势数据失败：%s", response.Error.Data)
+	}
+
+	return response.Result, nil
+}
+
+// GetUserMacro 查询不到返回空结构体
+func (z *Zabbix) GetUserMacro(hostid, macro string) (UserMacro, error) {
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "usermacro.get",
+		"params": map[string]interface{}{
+			"hostids": hostid,
+			"filter": map[string]interface{}{
+				"macro": []string{macro},
+			},
+		},
+		"id":   1,
+		"auth": z.token,
+	}
+
+	responseBody, err := z.RequestApi(payload)
+	if err != nil {
+		return UserMacro{}, fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+	}
+
+	var response struct {
+		Error  ResponseError `json:"error"`
+		Result []UserMacro   `json:"result"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return UserMacro{}, fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Error.Message != "" {
+		return UserMacro{}, fmt.Errorf("获取宏失败：%s", response.Error.Data)
+	}
+
+	if len(response.Result) > 0 {
+		return response.Result[0], nil
+	}
+
+	return UserMacro{}, nil
+}
+
+func (z *Zabbix) CreateUserMacro(hostid, macro, value string) (string, error) {
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "usermacro.create",
+		"params": map[string]interface{}{
+			"hostid": hostid,
+			"macro":  macro,
+			"value":  value,
+		},
+		"id":   1,
+		"auth": z.token,
+	}
+
+	responseBody, err := z.RequestApi(payload)
+	if err != nil {
+		return "", fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+	}
+
+	var response struct {
+		Error  ResponseError       `json:"error"`
+		Result map[string][]string `json:"result"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return "", fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Error.Message != "" {
+		return "", fmt.Errorf("创建宏失败：%s", response.Error.Data)
+	}
+
+	return response.Result["hostmacroids"][0], nil
+}
+
+func (z *Zabbix) UpdateUserMacro(hostMacroID, value string) (string, error) {
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "usermacro.update",
+		"params": map[string]interface{}{
+			"hostmacroid": hostMacroID,
+			"value":       value,
+		},
+		"id":   1,
+		"auth": z.token,
+	}
+
+	responseBody, err := z.RequestApi(payload)
+	if err != nil {
+		return "", fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+	}
+
+	var response struct {
+		Error  ResponseError       `json:"error"`
+		Result map[string][]string `json:"result"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return "", fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Error.Message != "" {
+		return "", fmt.Errorf("更新宏失败：%s", response.Error.Data)
+	}
+
+	return response.Result["hostmacroids"][0], nil
+}
+
+func (z *Zabbix) DeleteUserMacro(hostMacroID string) (string, error) {
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "usermacro.delete",
+		"params":  []string{hostMacroID},
+		"id":      1,
+		"auth":    z.token,
+	}
+
+	responseBody, err := z.RequestApi(payload)
+	if err != nil {
+		return "", fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+	}
+
+	var response struct {
+		Error  ResponseError       `json:"error"`
+		Result map[string][]string `json:"result"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return "", fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Error.Message != "" {
+		return "", fmt.Errorf("删除宏失败：%s", response.Error.Data)
+	}
+
+	if len(response.Result["hostmacroids"]) > 0 {
+		return response.Result["hostmacroids"][0], nil
+	}
+
+	return "", fmt.Errorf("宏不存在：%s", hostMacroID)
+}
+
+// GetProblems 获取日志告警触发器当前的问题，eventIDs 为空时返回全部
+func (z *Zabbix) GetProblems(eventIDs []string) ([]Problem, error) {
+	params := map[string]interface{}{
+		"output":   []string{"eventid", "objectid", "name", "clock"},
+		"source":   0,
+		"object":   0,
+		"evaltype": 0,
+		"tags": []map[string]string{
+			{"tag": "logs", "value": "alert", "operator": "1"},
+		},
+	}
+	if len(eventIDs) > 0 {
+		params["eventids"] = eventIDs
+	}
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "problem.get",
+		"params":  params,
+		"id":      1,
+		"auth":    z.token,
+	}
+
+	responseBody, err := z.RequestApi(payload)
+	if err != nil {
+		return []Problem{}, fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+	}
+
+	var response struct {
+		Error  ResponseError `json:"error"`
+		Result []Problem     `json:"result"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return []Problem{}, fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Error.Message != "" {
+		return []Problem{}, fmt.Errorf("获取问题失败：%s", response.Error.Data)
+	}
+
+	return response.Result, nil
+}
+
+// GetTriggersWithItems 获取触发器及其引用的监控项，包括监控项的查询 URL 和查询体
+func (z *Zabbix) GetTriggersWithItems(triggerIDs []string) ([]Trigger, error) {
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "trigger.get",
+		"params": map[string]interface{}{
+			"triggerids":  triggerIDs,
+			"output":      []string{"triggerid", "description", "comments", "expression"},
+			"selectItems": []string{"itemid", "hostid", "name", "key_", "url", "posts", "query_fields", "description"},
+		},
+		"id":   1,
+		"auth": z.token,
+	}
+
+	responseBody, err := z.RequestApi(payload)
+	if err != nil {
+		return []Trigger{}, fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+	}
+
+	var response struct {
+		Error  ResponseError `json:"error"`
+		Result []Trigger     `json:"result"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return []Trigger{}, fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Error.Message != "" {
+		return []Trigger{}, fmt.Errorf("获取触发器失败：%s", response.Error.Data)
+	}
+
+	return response.Result, nil
+}
+
+// AcknowledgeEvent 为事件添加一条确认消息，不关闭问题
+func (z *Zabbix) AcknowledgeEvent(eventID, message string) (string, error) {
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "event.acknowledge",
+		"params": map[string]interface{}{
+			"eventids": eventID,
+			"action":   4,
+			"message":  message,
+		},
+		"id":   1,
+		"auth": z.token,
+	}
+
+	responseBody, err := z.RequestApi(payload)
+	if err != nil {
+		return "", fmt.Errorf("请求ZabbixAPI失败：%s", err.Error())
+	}
+
+	var response struct {
+		Error ResponseError `json:"error"`
+		// 不同版本返回的事件 ID 可能是数字或字符串
+		Result map[string][]interface{} `json:"result"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return "", fmt.Errorf("解析响应失败：%s", err.Error())
+	}
+
+	if response.Error.Message != "" {
+		return "", fmt.Errorf("确认事件失败：%s", response.Error.Data)
+	}
+
+	return eventID, nil
+}
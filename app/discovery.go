@@ -0,0 +1,146 @@
+package main
+
+import (
+	"gin-zabbix/configs"
+	"gin-zabbix/connector"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type DiscoverIndicesParamQuery struct {
+	Pattern string `form:"pattern" binding:"required"`
+	Cluster string `form:"cluster"`
+}
+
+type DiscoverFieldsParamQuery struct {
+	Index   string `form:"index" binding:"required"`
+	Fields  string `form:"fields"`
+	Cluster string `form:"cluster"`
+}
+
+// DiscoverIndices
+// @Summary Discover Indices
+// @Schemes http
+// @Description 列出索引模式匹配到的索引、别名和数据流及其文档数，用于填写告警的 index 参数
+// @Tags discovery
+// @Accept json
+// @Produce json
+// @Param pattern query string true "索引模式，例如 logs-*"
+// @Param cluster query string false "Elasticsearch 集群名称，默认为 default"
+// @Success 200 {string} Success
+// @Security BasicAuth
+// @Router /v1/discovery/indices [get]
+func DiscoverIndices(c *gin.Context) {
+	var query DiscoverIndicesParamQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	config := c.MustGet("config").(configs.Config)
+	cluster, err := config.GetCluster(query.Cluster)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	if cluster.Backend == connector.BackendLoki {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  "索引发现暂不支持 Loki",
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	es := connector.NewElasticsearch(cluster)
+	indices, err := es.DiscoverIndices(query.Pattern)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"error":  "",
+		"data": map[string]interface{}{
+			"pattern": query.Pattern,
+			"indices": indices,
+		},
+	})
+}
+
+// DiscoverFields
+// @Summary Discover Fields
+// @Schemes http
+// @Description 列出索引模式下的字段及其类型，用于编写查询字符串和选择时间字段
+// @Tags discovery
+// @Accept json
+// @Produce json
+// @Param index query string true "索引"
+// @Param fields query string false "字段名过滤，支持通配符，默认为 *"
+// @Param cluster query string false "Elasticsearch 集群名称，默认为 default"
+// @Success 200 {string} Success
+// @Security BasicAuth
+// @Router /v1/discovery/fields [get]
+func DiscoverFields(c *gin.Context) {
+	var query DiscoverFieldsParamQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	config := c.MustGet("config").(configs.Config)
+	cluster, err := config.GetCluster(query.Cluster)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	if cluster.Backend == connector.BackendLoki {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  "字段发现暂不支持 Loki",
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	es := connector.NewElasticsearch(cluster)
+	fields, err := es.FieldCaps(query.Index, query.Fields)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"error":  "",
+		"data": map[string]interface{}{
+			"index":  query.Index,
+			"fields": fields,
+		},
+	})
+}
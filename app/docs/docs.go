@@ -20,14 +20,14 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/alert/creat": {
+        "/v1/alert/backtest": {
             "post": {
                 "security": [
                     {
                         "BasicAuth": []
                     }
                 ],
-                "description": "创建告警规则",
+                "description": "用历史日志回测告警规则，返回过去 N 天内告警触发的次数、时间和总时长",
                 "consumes": [
                     "application/json"
                 ],
@@ -37,7 +37,7 @@ const docTemplate = `{
                 "tags": [
                     "alert"
                 ],
-                "summary": "Creat Alert",
+                "summary": "Backtest Alert",
                 "parameters": [
                     {
                         "type": "string",
@@ -55,11 +55,131 @@ const docTemplate = `{
                     },
                     {
                         "type": "string",
-                        "description": "查询字符串",
+                        "description": "查询字符串，与请求体中的 query 二选一",
                         "name": "query_string",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Elasticsearch 集群名称，默认为 default",
+                        "name": "cluster",
+                        "in": "query"
+                    },
+                    {
+                        "description": "回测配置",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.BacktestAlertParamBody"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/alert/baseline": {
+            "get": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "查询动态基线告警当前阈值及计算历史",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "alert"
+                ],
+                "summary": "Query Baseline",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "名称",
+                        "name": "name",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "索引",
+                        "name": "index",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Elasticsearch 集群名称，默认为 default",
+                        "name": "cluster",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/alert/creat": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "创建告警规则",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "alert"
+                ],
+                "summary": "Creat Alert",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "名称",
+                        "name": "name",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "索引",
+                        "name": "index",
                         "in": "query",
                         "required": true
                     },
+                    {
+                        "type": "string",
+                        "description": "查询字符串，与请求体中的 query 二选一",
+                        "name": "query_string",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Elasticsearch 集群名称，默认为 default",
+                        "name": "cluster",
+                        "in": "query"
+                    },
                     {
                         "description": "默认配置",
                         "name": "request",
@@ -80,7 +200,7 @@ const docTemplate = `{
                 }
             }
         },
-        "/alert/delete": {
+        "/v1/alert/delete": {
             "delete": {
                 "security": [
                     {
@@ -112,6 +232,12 @@ const docTemplate = `{
                         "name": "index",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Elasticsearch 集群名称，默认为 default",
+                        "name": "cluster",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -124,14 +250,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/alert/query": {
+        "/v1/alert/enrichment": {
             "get": {
                 "security": [
                     {
                         "BasicAuth": []
                     }
                 ],
-                "description": "查询单个索引相关告警",
+                "description": "查询问题的告警上下文：命中最多的字段值和示例日志，尚未生成时立即生成",
                 "consumes": [
                     "application/json"
                 ],
@@ -141,12 +267,12 @@ const docTemplate = `{
                 "tags": [
                     "alert"
                 ],
-                "summary": "Query Alerts",
+                "summary": "Query Enrichment",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "索引",
-                        "name": "index",
+                        "description": "问题的事件 ID",
+                        "name": "event_id",
                         "in": "query",
                         "required": true
                     }
@@ -161,9 +287,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/monitor/health_check": {
+        "/v1/alert/export": {
             "get": {
-                "description": "健康检查",
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "将告警导出为 Elasticsearch Watcher JSON 或 ElastAlert 2 规则 YAML",
                 "consumes": [
                     "application/json"
                 ],
@@ -171,9 +302,36 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "monitor"
+                    "alert"
+                ],
+                "summary": "Export Alerts",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "watcher 或 elastalert",
+                        "name": "format",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Elasticsearch 集群名称，默认为 default",
+                        "name": "cluster",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "索引，为空时导出集群的全部告警",
+                        "name": "index",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "名称",
+                        "name": "name",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Health Check",
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -183,28 +341,1520 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "main.CreatAlertParamBody": {
-            "type": "object",
-            "required": [
-                "delay",
-                "description",
-                "threshold"
-            ],
-            "properties": {
-                "delay": {
-                    "type": "string",
-                    "example": "3m"
-                },
-                "description": {
-                    "type": "string",
-                    "example": "description"
-                },
-                "threshold": {
-                    "type": "string",
-                    "example": "\u003e=10"
+        },
+        "/v1/alert/export/watcher": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "将告警导出为 Watcher 并通过 _watcher API 写入告警所在的集群，已存在的 watch 会被更新",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "alert"
+                ],
+                "summary": "Install Watches",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Elasticsearch 集群名称，默认为 default",
+                        "name": "cluster",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "索引，为空时写入集群的全部告警",
+                        "name": "index",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "名称",
+                        "name": "name",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/alert/import": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "从 Kibana 已保存搜索（Saved Objects 导出的 NDJSON）或 Discover 链接创建告警，提取索引模式、查询语句和过滤条件",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "alert"
+                ],
+                "summary": "Import Alert",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "名称，默认为已保存搜索的标题",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "索引，默认为已保存搜索的索引模式",
+                        "name": "index",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Elasticsearch 集群名称，默认为 default",
+                        "name": "cluster",
+                        "in": "query"
+                    },
+                    {
+                        "description": "导入配置",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.ImportAlertParamBody"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/alert/import/elastalert": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "从 ElastAlert 规则创建告警：frequency 的 num_events 对应阈值 \u003e=N，flatline 的 threshold 对应阈值 \u003cN，spike_type 为 up 的 spike 规则映射为动态基线告警、spike_height 换算为基线余量，timeframe 对应统计窗口，query_delay 对应入库延迟，filter 对应查询条件；返回每个规则的结果、不支持的原因和忽略的字段",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "alert"
+                ],
+                "summary": "Import ElastAlert Rules",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Elasticsearch 集群名称，默认为 default",
+                        "name": "cluster",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "只转换规则并返回报告，不创建告警",
+                        "name": "dry_run",
+                        "in": "query"
+                    },
+                    {
+                        "description": "规则",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.ImportElastAlertParamBody"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/alert/preview": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "预览告警规则：立即执行查询，返回当前命中数、是否超过阈值以及示例文档",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "alert"
+                ],
+                "summary": "Preview Alert",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "名称",
+                        "name": "name",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "索引",
+                        "name": "index",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "查询字符串，与请求体中的 query 二选一",
+                        "name": "query_string",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Elasticsearch 集群名称，默认为 default",
+                        "name": "cluster",
+                        "in": "query"
+                    },
+                    {
+                        "description": "预览配置",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.PreviewAlertParamBody"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/alert/query": {
+            "get": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "查询单个索引相关告警",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "alert"
+                ],
+                "summary": "Query Alerts",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "索引",
+                        "name": "index",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Elasticsearch 集群名称，默认为 default",
+                        "name": "cluster",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/composite/creat": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "创建组合告警规则，引用已有告警并以 and/or 组合",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "composite"
+                ],
+                "summary": "Creat Composite Alert",
+                "parameters": [
+                    {
+                        "description": "组合配置",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.CreatCompositeAlertParamBody"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/composite/delete": {
+            "delete": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "删除组合告警规则，不影响被引用的告警",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "composite"
+                ],
+                "summary": "Delete Composite Alert",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "名称",
+                        "name": "name",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/composite/query": {
+            "get": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "查询全部组合告警及其引用的告警",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "composite"
+                ],
+                "summary": "Query Composite Alerts",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/discovery/fields": {
+            "get": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "列出索引模式下的字段及其类型，用于编写查询字符串和选择时间字段",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "discovery"
+                ],
+                "summary": "Discover Fields",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "索引",
+                        "name": "index",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "字段名过滤，支持通配符，默认为 *",
+                        "name": "fields",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Elasticsearch 集群名称，默认为 default",
+                        "name": "cluster",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/discovery/indices": {
+            "get": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "列出索引模式匹配到的索引、别名和数据流及其文档数，用于填写告警的 index 参数",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "discovery"
+                ],
+                "summary": "Discover Indices",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "索引模式，例如 logs-*",
+                        "name": "pattern",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Elasticsearch 集群名称，默认为 default",
+                        "name": "cluster",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/monitor/health_check": {
+            "get": {
+                "description": "健康检查",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "monitor"
+                ],
+                "summary": "Health Check",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/alerts": {
+            "get": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "列出全部集群和索引的告警，支持按索引前缀、名称、阈值、检查周期、标签、是否启用和是否触发筛选，以及排序和分页",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "alert-v2"
+                ],
+                "summary": "List Alerts",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 1,
+                        "description": "页码，从 1 开始",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "每页数量，最大 500",
+                        "name": "page_size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "name",
+                        "description": "排序字段：name、index、cluster、delay、threshold 或 id",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "asc",
+                        "description": "asc 或 desc",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "集群名称，为空时列出全部集群",
+                        "name": "cluster",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "索引前缀",
+                        "name": "index_prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "名称包含的文本，不区分大小写",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "阈值，如 \u003e=10",
+                        "name": "threshold",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "检查周期，如 1m",
+                        "name": "delay",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "监控项标签，tag 或 tag:value",
+                        "name": "tag",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "是否启用",
+                        "name": "enabled",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "是否处于触发状态",
+                        "name": "firing",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.AlertListResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "创建告警，成功时返回 201 和告警，Location 为告警地址；同名告警已存在时返回 409",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "alert-v2"
+                ],
+                "summary": "Create Alert",
+                "parameters": [
+                    {
+                        "description": "告警定义",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.AlertSpec"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.AlertResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/alerts/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "按 ID 获取告警",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "alert-v2"
+                ],
+                "summary": "Get Alert",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "告警 ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.AlertResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "用完整的定义替换告警，name、cluster 和 index 必须与原告警一致，动态基线告警不能修改",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "alert-v2"
+                ],
+                "summary": "Replace Alert",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "告警 ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "告警定义",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.AlertSpec"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.AlertResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "按 ID 删除告警，成功时返回 204",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "alert-v2"
+                ],
+                "summary": "Delete Alert",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "告警 ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "修改告警的部分字段，未提供的字段保持不变；只提供 query 时查询语法改为 dsl，dsl 告警只提供 query_string 时改为 lucene",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "alert-v2"
+                ],
+                "summary": "Patch Alert",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "告警 ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "要修改的字段",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.AlertSpec"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.AlertResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "connector.Tag": {
+            "type": "object",
+            "properties": {
+                "tag": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.Alert": {
+            "type": "object",
+            "properties": {
+                "cluster": {
+                    "type": "string"
+                },
+                "composites": {
+                    "description": "引用该告警的组合告警名称",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "delay": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "discover_url": {
+                    "description": "集群配置了 kibana_url 时返回 Discover 链接",
+                    "type": "string"
+                },
+                "elasticsearch": {
+                    "type": "string"
+                },
+                "enabled": {
+                    "description": "监控项和触发器均已启用，内置引擎的告警总是启用",
+                    "type": "boolean"
+                },
+                "firing": {
+                    "description": "触发器处于问题状态，内置引擎为 firing 状态",
+                    "type": "boolean"
+                },
+                "host_id": {
+                    "type": "string"
+                },
+                "host_name": {
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Zabbix 监控项 ID，内置引擎为 RuleAlertID，/api/v2/alerts/{id} 使用",
+                    "type": "string"
+                },
+                "index": {
+                    "type": "string"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "lag": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "query": {
+                    "description": "使用查询 DSL 或 KQL 创建的告警返回 DSL，使用查询 DSL 创建时 query_string 与之相同",
+                    "type": "object"
+                },
+                "query_language": {
+                    "description": "lucene、dsl 或 kql",
+                    "type": "string"
+                },
+                "query_string": {
+                    "type": "string"
+                },
+                "state": {
+                    "description": "内置告警引擎的执行状态",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.RuleState"
+                        }
+                    ]
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/connector.Tag"
+                    }
+                },
+                "threshold": {
+                    "type": "string"
+                },
+                "timestamp_field": {
+                    "type": "string"
+                },
+                "trapper": {
+                    "description": "trapper 模式下最近一次查询和推送的结果",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.TrapperStatus"
+                        }
+                    ]
+                },
+                "window": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.AlertListResponse": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.Alert"
+                    }
+                },
+                "page": {
+                    "type": "integer"
+                },
+                "page_size": {
+                    "type": "integer"
+                },
+                "total": {
+                    "description": "满足筛选条件的告警总数",
+                    "type": "integer"
+                }
+            }
+        },
+        "main.AlertResponse": {
+            "type": "object",
+            "properties": {
+                "cost": {
+                    "description": "profile 为 true 时的查询代价估算",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.CostEstimate"
+                        }
+                    ]
+                },
+                "data": {
+                    "$ref": "#/definitions/main.Alert"
+                },
+                "warnings": {
+                    "description": "创建或修改时的查询检查警告",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.LintIssue"
+                    }
+                }
+            }
+        },
+        "main.AlertSpec": {
+            "type": "object",
+            "required": [
+                "index",
+                "interval",
+                "name",
+                "threshold"
+            ],
+            "properties": {
+                "baseline": {
+                    "description": "只在创建时使用，修改已有告警时不能指定",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.BaselineParam"
+                        }
+                    ]
+                },
+                "cluster": {
+                    "type": "string",
+                    "example": "default"
+                },
+                "description": {
+                    "type": "string",
+                    "example": "description"
+                },
+                "index": {
+                    "type": "string",
+                    "example": "logs-*"
+                },
+                "interval": {
+                    "description": "检查周期",
+                    "type": "string",
+                    "example": "1m"
+                },
+                "lag": {
+                    "type": "string",
+                    "example": "1m"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "error logs"
+                },
+                "profile": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "query": {
+                    "description": "查询 DSL，query_language 为 dsl 时使用",
+                    "type": "object"
+                },
+                "query_language": {
+                    "description": "lucene、kql 或 dsl，为空时提供 query 即为 dsl，否则为 lucene",
+                    "type": "string",
+                    "enum": [
+                        "lucene",
+                        "kql",
+                        "dsl"
+                    ],
+                    "example": "kql"
+                },
+                "query_string": {
+                    "description": "lucene 或 kql 查询语句",
+                    "type": "string",
+                    "example": "level:error"
+                },
+                "threshold": {
+                    "type": "string",
+                    "example": "\u003e=10"
+                },
+                "timestamp_field": {
+                    "type": "string",
+                    "example": "@timestamp"
+                },
+                "window": {
+                    "description": "统计窗口，为空时与检查周期相同",
+                    "type": "string",
+                    "example": "15m"
+                }
+            }
+        },
+        "main.BacktestAlertParamBody": {
+            "type": "object",
+            "required": [
+                "threshold"
+            ],
+            "properties": {
+                "days": {
+                    "type": "integer",
+                    "maximum": 90,
+                    "minimum": 1,
+                    "example": 7
+                },
+                "delay": {
+                    "type": "string",
+                    "example": "3m"
+                },
+                "interval": {
+                    "description": "检查周期，delay 为兼容旧版本保留的同义字段",
+                    "type": "string",
+                    "example": "1m"
+                },
+                "lag": {
+                    "type": "string",
+                    "example": "1m"
+                },
+                "query": {
+                    "description": "查询 DSL，与 query_string 二选一",
+                    "type": "object"
+                },
+                "query_language": {
+                    "description": "query_string 的语法，默认为 lucene",
+                    "type": "string",
+                    "enum": [
+                        "lucene",
+                        "kql"
+                    ],
+                    "example": "kql"
+                },
+                "threshold": {
+                    "type": "string",
+                    "example": "\u003e=10"
+                },
+                "timestamp_field": {
+                    "description": "时间字段，为空时从索引映射中自动识别",
+                    "type": "string",
+                    "example": "@timestamp"
+                },
+                "window": {
+                    "type": "string",
+                    "example": "15m"
+                }
+            }
+        },
+        "main.BaselineParam": {
+            "type": "object",
+            "properties": {
+                "margin": {
+                    "type": "number",
+                    "example": 20
+                },
+                "percentile": {
+                    "type": "number",
+                    "maximum": 100,
+                    "example": 95
+                }
+            }
+        },
+        "main.CompositeMember": {
+            "type": "object",
+            "required": [
+                "index",
+                "name"
+            ],
+            "properties": {
+                "cluster": {
+                    "description": "Elasticsearch 集群名称，默认为 default",
+                    "type": "string",
+                    "example": "default"
+                },
+                "index": {
+                    "type": "string",
+                    "example": "payment-*"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "payment errors"
+                },
+                "threshold": {
+                    "description": "为空时沿用被引用告警自身触发器的阈值",
+                    "type": "string",
+                    "example": "\u003e=10"
+                }
+            }
+        },
+        "main.CostEstimate": {
+            "type": "object",
+            "properties": {
+                "daily_query_ms": {
+                    "description": "按检查周期估算的每天查询耗时",
+                    "type": "number"
+                },
+                "query_ms": {
+                    "description": "各分片查询阶段耗时之和",
+                    "type": "number"
+                },
+                "runs_per_day": {
+                    "type": "integer"
+                },
+                "shards": {
+                    "type": "integer"
+                },
+                "took_ms": {
+                    "description": "请求总耗时",
+                    "type": "integer"
+                }
+            }
+        },
+        "main.CreatAlertParamBody": {
+            "type": "object",
+            "required": [
+                "description",
+                "threshold"
+            ],
+            "properties": {
+                "baseline": {
+                    "description": "启用动态基线时，threshold 中的数值仅作为基线计算出来之前的初始阈值",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.BaselineParam"
+                        }
+                    ]
+                },
+                "delay": {
+                    "type": "string",
+                    "example": "3m"
+                },
+                "description": {
+                    "type": "string",
+                    "example": "description"
+                },
+                "interval": {
+                    "description": "检查周期，delay 为兼容旧版本保留的同义字段",
+                    "type": "string",
+                    "example": "1m"
+                },
+                "lag": {
+                    "description": "入库延迟，统计区间整体向前平移，统计 [now-lag-window, now-lag]",
+                    "type": "string",
+                    "example": "1m"
+                },
+                "profile": {
+                    "description": "创建前使用 _search?profile 执行一次查询并估算每天的查询耗时",
+                    "type": "boolean",
+                    "example": false
+                },
+                "query": {
+                    "description": "查询 DSL，与 query_string 二选一，服务会自动加上时间范围",
+                    "type": "object"
+                },
+                "query_language": {
+                    "description": "query_string 的语法，kql 时翻译为查询 DSL 保存，默认为 lucene",
+                    "type": "string",
+                    "enum": [
+                        "lucene",
+                        "kql"
+                    ],
+                    "example": "kql"
+                },
+                "threshold": {
+                    "type": "string",
+                    "example": "\u003e=10"
+                },
+                "timestamp_field": {
+                    "description": "时间字段，为空时从索引映射中自动识别",
+                    "type": "string",
+                    "example": "@timestamp"
+                },
+                "window": {
+                    "description": "统计窗口，为空时与检查周期相同",
+                    "type": "string",
+                    "example": "15m"
+                }
+            }
+        },
+        "main.CreatCompositeAlertParamBody": {
+            "type": "object",
+            "required": [
+                "alerts",
+                "name",
+                "operator"
+            ],
+            "properties": {
+                "alerts": {
+                    "type": "array",
+                    "minItems": 2,
+                    "items": {
+                        "$ref": "#/definitions/main.CompositeMember"
+                    }
+                },
+                "description": {
+                    "type": "string",
+                    "example": "description"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "payment degraded"
+                },
+                "operator": {
+                    "type": "string",
+                    "enum": [
+                        "and",
+                        "or"
+                    ],
+                    "example": "and"
+                }
+            }
+        },
+        "main.ErrorDetail": {
+            "type": "object",
+            "properties": {
+                "details": {
+                    "description": "附加信息，如查询检查拒绝时的警告",
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "$ref": "#/definitions/main.ErrorDetail"
+                }
+            }
+        },
+        "main.ImportAlertParamBody": {
+            "type": "object",
+            "required": [
+                "description",
+                "threshold"
+            ],
+            "properties": {
+                "baseline": {
+                    "description": "启用动态基线时，threshold 中的数值仅作为基线计算出来之前的初始阈值",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.BaselineParam"
+                        }
+                    ]
+                },
+                "delay": {
+                    "type": "string",
+                    "example": "3m"
+                },
+                "description": {
+                    "type": "string",
+                    "example": "description"
+                },
+                "discover_url": {
+                    "description": "Discover 链接，未指定 window 时使用链接中 now-15m 形式的时间范围作为统计窗口",
+                    "type": "string",
+                    "example": "https://127.0.0.1:5601/app/discover#/?_a=(index:'logs-*',query:(language:kuery,query:'level:error'))"
+                },
+                "interval": {
+                    "description": "检查周期，delay 为兼容旧版本保留的同义字段",
+                    "type": "string",
+                    "example": "1m"
+                },
+                "lag": {
+                    "description": "入库延迟，统计区间整体向前平移，统计 [now-lag-window, now-lag]",
+                    "type": "string",
+                    "example": "1m"
+                },
+                "ndjson": {
+                    "description": "Saved Objects 导出的 NDJSON，与 discover_url 二选一，其中的每个已保存搜索创建一个告警",
+                    "type": "string"
+                },
+                "profile": {
+                    "description": "创建前使用 _search?profile 执行一次查询并估算每天的查询耗时",
+                    "type": "boolean",
+                    "example": false
+                },
+                "query": {
+                    "description": "查询 DSL，与 query_string 二选一，服务会自动加上时间范围",
+                    "type": "object"
+                },
+                "query_language": {
+                    "description": "query_string 的语法，kql 时翻译为查询 DSL 保存，默认为 lucene",
+                    "type": "string",
+                    "enum": [
+                        "lucene",
+                        "kql"
+                    ],
+                    "example": "kql"
+                },
+                "threshold": {
+                    "type": "string",
+                    "example": "\u003e=10"
+                },
+                "timestamp_field": {
+                    "description": "时间字段，为空时从索引映射中自动识别",
+                    "type": "string",
+                    "example": "@timestamp"
+                },
+                "window": {
+                    "description": "统计窗口，为空时与检查周期相同",
+                    "type": "string",
+                    "example": "15m"
+                }
+            }
+        },
+        "main.ImportElastAlertParamBody": {
+            "type": "object",
+            "required": [
+                "rules"
+            ],
+            "properties": {
+                "description": {
+                    "description": "规则中没有 description 时使用的描述，为空时使用规则名称",
+                    "type": "string",
+                    "example": "imported from ElastAlert"
+                },
+                "interval": {
+                    "description": "规则中没有 run_every 时使用的检查周期，默认为 1m",
+                    "type": "string",
+                    "example": "1m"
+                },
+                "rules": {
+                    "description": "规则文件内容，多个规则以 --- 分隔",
+                    "type": "string",
+                    "example": "name: errors\ntype: frequency\nindex: logs-*\nnum_events: 10\ntimeframe:\n  minutes: 15\nfilter:\n- query:\n    query_string:\n      query: \"level:error\""
+                }
+            }
+        },
+        "main.LintIssue": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                },
+                "rule": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.PreviewAlertParamBody": {
+            "type": "object",
+            "properties": {
+                "delay": {
+                    "type": "string",
+                    "example": "3m"
+                },
+                "fields": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "@timestamp",
+                        "message"
+                    ]
+                },
+                "interval": {
+                    "type": "string",
+                    "example": "1m"
+                },
+                "lag": {
+                    "type": "string",
+                    "example": "1m"
+                },
+                "query": {
+                    "description": "查询 DSL，与 query_string 二选一",
+                    "type": "object"
+                },
+                "query_language": {
+                    "description": "query_string 的语法，默认为 lucene",
+                    "type": "string",
+                    "enum": [
+                        "lucene",
+                        "kql"
+                    ],
+                    "example": "kql"
+                },
+                "size": {
+                    "type": "integer",
+                    "maximum": 100,
+                    "minimum": 1,
+                    "example": 10
+                },
+                "threshold": {
+                    "type": "string",
+                    "example": "\u003e=10"
+                },
+                "timestamp_field": {
+                    "description": "时间字段，为空时从索引映射中自动识别",
+                    "type": "string",
+                    "example": "@timestamp"
+                },
+                "window": {
+                    "type": "string",
+                    "example": "15m"
+                }
+            }
+        },
+        "main.RuleState": {
+            "type": "object",
+            "properties": {
+                "changed_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "description": "最近一次执行失败的原因，失败时保持原状态",
+                    "type": "string"
+                },
+                "evaluated_at": {
+                    "type": "string"
+                },
+                "state": {
+                    "description": "ok、pending（本次超过阈值但触发器尚未触发）、firing 或 resolved（上次为 firing，本次恢复）",
+                    "type": "string"
+                },
+                "value": {
+                    "type": "number"
+                },
+                "values": {
+                    "description": "最近几次检查的命中数，按时间顺序，最多保留触发器需要的个数",
+                    "type": "array",
+                    "items": {
+                        "type": "number"
+                    }
+                }
+            }
+        },
+        "main.TrapperStatus": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "查询失败或推送失败的原因",
+                    "type": "string"
+                },
+                "last_run": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "integer"
                 }
             }
         }
@@ -220,7 +1870,7 @@ const docTemplate = `{
 var SwaggerInfo = &swag.Spec{
 	Version:          "1.0",
 	Host:             "",
-	BasePath:         "/api/v1",
+	BasePath:         "/api",
 	Schemes:          []string{},
 	Title:            "Log Alarm Management Service",
 	Description:      "",
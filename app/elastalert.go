@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gin-zabbix/configs"
+	"gin-zabbix/connector"
+	"gin-zabbix/store"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 导入 ElastAlert 规则：frequency、flatline 和 spike 规则与 CreatAlert 走同一流程创建告警，
+// 不支持的规则和导入时忽略的字段记录在报告中
+
+const (
+	elastAlertStatusSuccess     = "success"
+	elastAlertStatusFailure     = "failure"
+	elastAlertStatusUnsupported = "unsupported"
+	defaultElastAlertInterval   = "1m"
+)
+
+type ImportElastAlertParamBody struct {
+	// 规则文件内容，多个规则以 --- 分隔
+	Rules string `json:"rules" binding:"required" example:"name: errors\ntype: frequency\nindex: logs-*\nnum_events: 10\ntimeframe:\n  minutes: 15\nfilter:\n- query:\n    query_string:\n      query: \"level:error\""`
+	// 规则中没有 run_every 时使用的检查周期，默认为 1m
+	Interval string `json:"interval" binding:"omitempty,duration" example:"1m"`
+	// 规则中没有 description 时使用的描述，为空时使用规则名称
+	Description string `json:"description" example:"imported from ElastAlert"`
+}
+
+type ImportElastAlertParamQuery struct {
+	Cluster string `form:"cluster"`
+	// 只转换规则并返回报告，不创建告警
+	DryRun bool `form:"dry_run"`
+}
+
+// ElastAlertImportOptions 导入时的默认值
+type ElastAlertImportOptions struct {
+	Cluster     string
+	Interval    string
+	Description string
+	DryRun      bool
+}
+
+// ElastAlertImportResult 每个规则的导入结果
+type ElastAlertImportResult struct {
+	File  string `json:"file,omitempty"`
+	Name  string `json:"name"`
+	Index string `json:"index"`
+	Type  string `json:"type"`
+	// success、failure（创建告警失败）或 unsupported（规则无法映射）
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	// 导入时忽略的字段
+	Ignored []string `json:"ignored"`
+	// 转换后的告警定义
+	Alert *connector.ElastAlertImport `json:"alert,omitempty"`
+	Data  map[string]interface{}      `json:"data"`
+}
+
+// importElastAlertRule 转换规则并创建告警
+func importElastAlertRule(config configs.Config, st *store.Store, options ElastAlertImportOptions, file string, rule map[string]interface{}) ElastAlertImportResult {
+	converted, err := connector.ConvertElastAlertRule(rule)
+	result := ElastAlertImportResult{
+		File:    file,
+		Name:    converted.Name,
+		Index:   converted.Index,
+		Type:    converted.Type,
+		Status:  elastAlertStatusUnsupported,
+		Ignored: converted.Ignored,
+		Data:    map[string]interface{}{},
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if converted.Interval == "" {
+		converted.Interval = options.Interval
+	}
+	if converted.Description == "" {
+		converted.Description = options.Description
+	}
+	if converted.Description == "" {
+		converted.Description = converted.Name
+	}
+	result.Alert = &converted
+	if options.DryRun {
+		result.Status = elastAlertStatusSuccess
+		return result
+	}
+
+	alertQuery := CreatAlertParamQuery{
+		Name:        converted.Name,
+		Index:       converted.Index,
+		QueryString: converted.QueryString,
+		Cluster:     options.Cluster,
+	}
+	alertBody := CreatAlertParamBody{
+		Description:    converted.Description,
+		Interval:       converted.Interval,
+		Window:         converted.Window,
+		Lag:            converted.Lag,
+		Threshold:      converted.Threshold,
+		TimestampField: converted.TimestampField,
+		Query:          converted.Query,
+	}
+	if converted.Baseline != nil {
+		alertBody.Baseline = &BaselineParam{Margin: converted.Baseline.Margin}
+	}
+	data, _, err := CreateAlert(config, st, alertQuery, alertBody)
+	if data != nil {
+		result.Data = data
+	}
+	if err != nil {
+		result.Status = elastAlertStatusFailure
+		result.Error = err.Error()
+		return result
+	}
+	result.Status = elastAlertStatusSuccess
+	return result
+}
+
+// ImportElastAlertRules 导入一个规则文件中的全部规则，文件无法解析时返回错误
+func ImportElastAlertRules(config configs.Config, st *store.Store, options ElastAlertImportOptions, file string, data []byte) ([]ElastAlertImportResult, error) {
+	rules, err := connector.ParseElastAlertRules(data)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]ElastAlertImportResult, 0, len(rules))
+	for _, rule := range rules {
+		results = append(results, importElastAlertRule(config, st, options, file, rule))
+	}
+	return results, nil
+}
+
+// ImportElastAlert
+// @Summary Import ElastAlert Rules
+// @Schemes http
+// @Description 从 ElastAlert 规则创建告警：frequency 的 num_events 对应阈值 >=N，flatline 的 threshold 对应阈值 <N，spike_type 为 up 的 spike 规则映射为动态基线告警、spike_height 换算为基线余量，timeframe 对应统计窗口，query_delay 对应入库延迟，filter 对应查询条件；返回每个规则的结果、不支持的原因和忽略的字段
+// @Tags alert
+// @Accept json
+// @Produce json
+// @Param cluster query string false "Elasticsearch 集群名称，默认为 default"
+// @Param dry_run query bool false "只转换规则并返回报告，不创建告警"
+// @Param request body ImportElastAlertParamBody true "规则"
+// @Success 200 {string} Success
+// @Security BasicAuth
+// @Router /v1/alert/import/elastalert [post]
+func ImportElastAlert(c *gin.Context) {
+	var body ImportElastAlertParamBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	var query ImportElastAlertParamQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	config := c.MustGet("config").(configs.Config)
+	st := c.MustGet("store").(*store.Store)
+	options := ElastAlertImportOptions{
+		Cluster:     query.Cluster,
+		Interval:    body.Interval,
+		Description: body.Description,
+		DryRun:      query.DryRun,
+	}
+	if options.Interval == "" {
+		options.Interval = defaultElastAlertInterval
+	}
+	results, err := ImportElastAlertRules(config, st, options, "", []byte(body.Rules))
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	if len(results) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  "没有 ElastAlert 规则",
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Status != elastAlertStatusSuccess {
+			failed++
+		}
+	}
+	switch {
+	case failed == 0:
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"error":  "",
+			"data":   results,
+		})
+	case failed == len(results):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  results[0].Error,
+			"data":   results,
+		})
+	default:
+		c.JSON(http.StatusMultiStatus, gin.H{
+			"status": "failure",
+			"error":  fmt.Sprintf("%d 个规则导入失败", failed),
+			"data":   results,
+		})
+	}
+}
+
+// elastAlertRuleFiles 展开参数中的文件和目录，目录下读取 .yaml 和 .yml 文件（不递归）
+func elastAlertRuleFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			extension := strings.ToLower(filepath.Ext(entry.Name()))
+			if entry.IsDir() || extension != ".yaml" && extension != ".yml" {
+				continue
+			}
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// RunImportElastAlertCommand import-elastalert 子命令：读取规则文件或目录创建告警，
+// 每个规则的结果输出到标准错误，-report 时把完整报告写入 JSON 文件
+func RunImportElastAlertCommand(config configs.Config, st *store.Store, args []string) error {
+	flags := flag.NewFlagSet("import-elastalert", flag.ContinueOnError)
+	cluster := flags.String("cluster", "", "Elasticsearch 集群名称，默认为 default")
+	interval := flags.String("interval", defaultElastAlertInterval, "规则中没有 run_every 时使用的检查周期")
+	description := flags.String("description", "", "规则中没有 description 时使用的描述，为空时使用规则名称")
+	dryRun := flags.Bool("dry-run", false, "只转换规则并输出报告，不创建告警")
+	report := flags.String("report", "", "报告文件，为空时不写入")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if !durationPattern.MatchString(*interval) {
+		return fmt.Errorf("无法解析检查周期：%s", *interval)
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("请指定规则文件或目录")
+	}
+	files, err := elastAlertRuleFiles(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	options := ElastAlertImportOptions{
+		Cluster:     *cluster,
+		Interval:    *interval,
+		Description: *description,
+		DryRun:      *dryRun,
+	}
+	results := []ElastAlertImportResult{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("读取文件失败：%s", err.Error())
+		}
+		fileResults, err := ImportElastAlertRules(config, st, options, file, data)
+		if err != nil {
+			// 无法解析的文件记为一条不支持的结果，不影响其他文件
+			fileResults = []ElastAlertImportResult{{
+				File:    file,
+				Status:  elastAlertStatusUnsupported,
+				Error:   err.Error(),
+				Ignored: []string{},
+				Data:    map[string]interface{}{},
+			}}
+		}
+		results = append(results, fileResults...)
+	}
+
+	counts := map[string]int{}
+	for _, result := range results {
+		counts[result.Status]++
+		line := fmt.Sprintf("%s：%s：%s", result.File, result.Name, result.Status)
+		if result.Error != "" {
+			line += "：" + result.Error
+		}
+		if len(result.Ignored) > 0 {
+			line += "（忽略字段：" + strings.Join(result.Ignored, ", ") + "）"
+		}
+		fmt.Fprintln(os.Stderr, line)
+	}
+	fmt.Fprintf(os.Stderr, "共 %d 个规则：成功 %d，失败 %d，不支持 %d\n", len(results),
+		counts[elastAlertStatusSuccess], counts[elastAlertStatusFailure], counts[elastAlertStatusUnsupported])
+
+	if *report != "" {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("JSON编码失败：%s", err.Error())
+		}
+		err = os.WriteFile(*report, append(data, '\n'), 0644)
+		if err != nil {
+			return fmt.Errorf("写入文件失败：%s", err.Error())
+		}
+	}
+	if counts[elastAlertStatusFailure] > 0 {
+		return fmt.Errorf("%d 个规则导入失败", counts[elastAlertStatusFailure])
+	}
+	return nil
+}
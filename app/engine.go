@@ -0,0 +1,346 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"gin-zabbix/configs"
+	"gin-zabbix/connector"
+	"gin-zabbix/store"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// 内置告警引擎：不使用 Zabbix 时，由本服务按检查周期执行告警查询并判断阈值，
+// 告警定义和状态保存在本地数据目录。
+
+const (
+	alertingInternal   = "internal"
+	ruleStoreName      = "rules"
+	ruleStateStoreName = "rule_states"
+)
+
+const (
+	ruleStateOK       = "ok"
+	ruleStatePending  = "pending"
+	ruleStateFiring   = "firing"
+	ruleStateResolved = "resolved"
+)
+
+var errRuleExists = errors.New("告警已存在")
+
+// Rule 内置引擎执行的告警，对应 Zabbix 模式下的监控项和触发器
+type Rule struct {
+	ID             string               `json:"id"`
+	Name           string               `json:"name"`
+	Key            string               `json:"key"`
+	Cluster        string               `json:"cluster"`
+	Index          string               `json:"index"`
+	QueryString    string               `json:"query_string"`
+	QueryLanguage  string               `json:"query_language"`
+	Query          json.RawMessage      `json:"query,omitempty"`
+	Delay          string               `json:"delay"`
+	Window         string               `json:"window"`
+	TimestampField string               `json:"timestamp_field"`
+	Lag            string               `json:"lag"`
+	Threshold      string               `json:"threshold"`
+	Description    string               `json:"description"`
+	DiscoverURL    string               `json:"discover_url,omitempty"`
+	Request        connector.LogRequest `json:"request"`
+}
+
+type RuleState struct {
+	// ok、pending（本次超过阈值但触发器尚未触发）、firing 或 resolved（上次为 firing，本次恢复）
+	State string  `json:"state"`
+	Value float64 `json:"value"`
+	// 最近几次检查的命中数，按时间顺序，最多保留触发器需要的个数
+	Values      []float64 `json:"values"`
+	EvaluatedAt time.Time `json:"evaluated_at"`
+	ChangedAt   time.Time `json:"changed_at"`
+	// 最近一次执行失败的原因，失败时保持原状态
+	Error string `json:"error,omitempty"`
+}
+
+// RuleID 与 Zabbix 模式相同，同一主机（索引）下监控项 key（名称的 MD5）唯一
+func RuleID(cluster, index, key string) string {
+	return ClusterHostName(cluster, index) + "/" + key
+}
+
+// RuleAlertID 接口中使用的告警 ID，规则 ID 含有 /，不能直接作为路径参数，取其 MD5
+func RuleAlertID(ruleID string) string {
+	hash := md5.Sum([]byte(ruleID))
+	return hex.EncodeToString(hash[:])
+}
+
+func LoadRules(st *store.Store) (map[string]Rule, error) {
+	rules := map[string]Rule{}
+	err := st.Load(ruleStoreName, &rules)
+	return rules, err
+}
+
+// AddRule 保存新的告警，同名告警已存在时返回 errRuleExists
+func AddRule(st *store.Store, rule Rule) error {
+	rules := map[string]Rule{}
+	return st.Update(ruleStoreName, &rules, func() error {
+		if _, ok := rules[rule.ID]; ok {
+			return errRuleExists
+		}
+		rules[rule.ID] = rule
+		return nil
+	})
+}
+
+// DeleteRule 删除告警，不存在时返回 false，状态在下次执行时清理
+func DeleteRule(st *store.Store, id string) (bool, error) {
+	found := false
+	rules := map[string]Rule{}
+	err := st.Update(ruleStoreName, &rules, func() error {
+		_, found = rules[id]
+		delete(rules, id)
+		return nil
+	})
+	return found, err
+}
+
+// FindRule 按 RuleAlertID 查找告警
+func FindRule(st *store.Store, alertID string) (Rule, bool, error) {
+	rules, err := LoadRules(st)
+	if err != nil {
+		return Rule{}, false, err
+	}
+	for id, rule := range rules {
+		if RuleAlertID(id) == alertID {
+			return rule, true, nil
+		}
+	}
+	return Rule{}, false, nil
+}
+
+// UpdateRule 替换已有的告警定义，不存在时返回 false，状态保留
+func UpdateRule(st *store.Store, rule Rule) (bool, error) {
+	found := false
+	rules := map[string]Rule{}
+	err := st.Update(ruleStoreName, &rules, func() error {
+		if _, found = rules[rule.ID]; found {
+			rules[rule.ID] = rule
+		}
+		return nil
+	})
+	return found, err
+}
+
+func LoadRuleStates(st *store.Store) (map[string]RuleState, error) {
+	states := map[string]RuleState{}
+	err := st.Load(ruleStateStoreName, &states)
+	return states, err
+}
+
+// NextRuleState 根据最近几次的命中数计算新状态，是否触发与 Zabbix 触发器相同，由 EvaluateTrigger 判断
+func NextRuleState(state RuleState, threshold string, values []float64) (string, error) {
+	firing, err := EvaluateTrigger(threshold, values)
+	if err != nil {
+		return "", err
+	}
+	if firing {
+		return ruleStateFiring, nil
+	}
+	if state.State == ruleStateFiring {
+		return ruleStateResolved, nil
+	}
+	breached, err := EvaluateThreshold(threshold, values[len(values)-1])
+	if err != nil {
+		return "", err
+	}
+	if breached {
+		return ruleStatePending, nil
+	}
+	return ruleStateOK, nil
+}
+
+// EvaluateRule 执行一次告警查询，返回命中数
+func EvaluateRule(config configs.Config, rule Rule) (float64, error) {
+	cluster, err := config.GetCluster(rule.Cluster)
+	if err != nil {
+		return 0, err
+	}
+	backend, err := connector.NewLogBackend(cluster)
+	if err != nil {
+		return 0, err
+	}
+	result, err := backend.Preview(rule.Index, rule.Request, connector.PreviewOptions{})
+	if err != nil {
+		return 0, err
+	}
+	return float64(result.Total), nil
+}
+
+// refreshRules 执行到期的告警，未执行过或距上次执行已超过检查周期即为到期
+func refreshRules(config configs.Config, st *store.Store) {
+	rules, err := LoadRules(st)
+	if err != nil {
+		log.Printf("读取告警失败：%s", err.Error())
+		return
+	}
+	states, err := LoadRuleStates(st)
+	if err != nil {
+		log.Printf("读取告警状态失败：%s", err.Error())
+		return
+	}
+
+	ids := make([]string, 0, len(rules))
+	for id := range rules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	now := time.Now()
+	for _, id := range ids {
+		rule := rules[id]
+		state, ok := states[id]
+		if !ok {
+			state = RuleState{State: ruleStateOK, ChangedAt: now}
+		}
+		interval, err := connector.ParseDuration(rule.Delay)
+		if err != nil {
+			state.Error = "无法解析检查周期：" + rule.Delay
+			states[id] = state
+			continue
+		}
+		if !state.EvaluatedAt.IsZero() && now.Sub(state.EvaluatedAt) < interval {
+			continue
+		}
+
+		state.EvaluatedAt = now
+		value, err := EvaluateRule(config, rule)
+		if err != nil {
+			log.Printf("执行告警 %s 失败：%s", id, err.Error())
+			state.Error = err.Error()
+			states[id] = state
+			continue
+		}
+		// 只保留触发器需要的最近几次命中数
+		values := append(state.Values, value)
+		if len(values) > triggerCount {
+			values = values[len(values)-triggerCount:]
+		}
+		next, err := NextRuleState(state, rule.Threshold, values)
+		if err != nil {
+			log.Printf("执行告警 %s 失败：%s", id, err.Error())
+			state.Error = err.Error()
+			states[id] = state
+			continue
+		}
+		if next != state.State {
+			log.Printf("告警 %s 状态由 %s 变为 %s，命中数 %g", id, state.State, next, value)
+			state.ChangedAt = now
+		}
+		state.State = next
+		state.Value = value
+		state.Values = values
+		state.Error = ""
+		states[id] = state
+	}
+
+	// 清理已删除告警的状态
+	for id := range states {
+		if _, ok := rules[id]; !ok {
+			delete(states, id)
+		}
+	}
+	err = st.Save(ruleStateStoreName, states)
+	if err != nil {
+		log.Printf("保存告警状态失败：%s", err.Error())
+	}
+}
+
+// RunRules 内置引擎按配置的周期检查到期的告警
+func RunRules(config configs.Config, st *store.Store) {
+	interval, err := time.ParseDuration(config.Alerting.Interval)
+	if err != nil {
+		log.Printf("告警引擎检查周期配置错误：%s", err.Error())
+		return
+	}
+	refreshRules(config, st)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		refreshRules(config, st)
+	}
+}
+
+// RuleAlert 将内置引擎的告警转换为与 Zabbix 模式相同的告警视图
+func RuleAlert(config configs.Config, rule Rule, state *RuleState) Alert {
+	cluster, _ := config.GetCluster(rule.Cluster)
+	clusterName := rule.Cluster
+	if clusterName == "" {
+		clusterName = configs.DefaultCluster
+	}
+	return Alert{
+		ID:             RuleAlertID(rule.ID),
+		Name:           rule.Name,
+		Key:            rule.Key,
+		HostName:       ClusterHostName(rule.Cluster, rule.Index),
+		Elasticsearch:  cluster.Url,
+		Cluster:        clusterName,
+		Index:          rule.Index,
+		QueryString:    rule.QueryString,
+		QueryLanguage:  rule.QueryLanguage,
+		Query:          rule.Query,
+		Delay:          rule.Delay,
+		Window:         rule.Window,
+		TimestampField: rule.TimestampField,
+		Lag:            rule.Lag,
+		Threshold:      rule.Threshold,
+		Description:    rule.Description,
+		Composites:     []string{},
+		DiscoverURL:    rule.DiscoverURL,
+		State:          state,
+		Enabled:        true,
+		Firing:         state != nil && state.State == ruleStateFiring,
+	}
+}
+
+// requireZabbix 组合告警、动态基线和告警上下文依赖 Zabbix，内置引擎下不可用
+func requireZabbix(c *gin.Context) {
+	config := c.MustGet("config").(configs.Config)
+	if config.Alerting.Backend == alertingInternal {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  "内置告警引擎不支持该接口",
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	c.Next()
+}
+
+// QueryRules 返回集群中指定索引的告警及其状态
+func QueryRules(config configs.Config, st *store.Store, cluster, index string) ([]Alert, error) {
+	rules, err := LoadRules(st)
+	if err != nil {
+		return nil, err
+	}
+	states, err := LoadRuleStates(st)
+	if err != nil {
+		return nil, err
+	}
+	hostName := ClusterHostName(cluster, index)
+	var alerts []Alert
+	for id, rule := range rules {
+		if rule.Index != index || ClusterHostName(rule.Cluster, rule.Index) != hostName {
+			continue
+		}
+		var state *RuleState
+		if s, ok := states[id]; ok {
+			state = &s
+		}
+		alerts = append(alerts, RuleAlert(config, rule, state))
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Name < alerts[j].Name
+	})
+	return alerts, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestEvaluateTrigger(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold string
+		values    []float64
+		want      bool
+	}{
+		{"no values", ">=10", nil, false},
+		{"fewer than three values", ">=10", []float64{20, 20}, false},
+		{"third most recent breached", ">=10", []float64{10, 0, 0}, true},
+		{"only latest breached", ">=10", []float64{0, 0, 10}, false},
+		{"older values ignored", ">=10", []float64{0, 20, 5, 5}, true},
+		{"less than", "<1", []float64{0, 5, 5}, true},
+		{"not equal", "<>0", []float64{0, 1, 1}, false},
+	}
+	for _, test := range tests {
+		got, err := EvaluateTrigger(test.threshold, test.values)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: EvaluateTrigger(%q, %v) = %v, want %v", test.name, test.threshold, test.values, got, test.want)
+		}
+	}
+	if _, err := EvaluateTrigger("10", nil); err == nil {
+		t.Error("EvaluateTrigger accepted a threshold without operator")
+	}
+}
+
+func TestNextRuleState(t *testing.T) {
+	tests := []struct {
+		name   string
+		state  string
+		values []float64
+		want   string
+	}{
+		{"ok", ruleStateOK, []float64{0, 0, 0}, ruleStateOK},
+		{"pending on first breach", ruleStateOK, []float64{0, 0, 20}, ruleStatePending},
+		{"pending before three values", ruleStateOK, []float64{20}, ruleStatePending},
+		{"pending until third value breaches", ruleStatePending, []float64{0, 20, 20}, ruleStatePending},
+		{"firing", ruleStatePending, []float64{20, 20, 20}, ruleStateFiring},
+		{"stays firing", ruleStateFiring, []float64{20, 0, 0}, ruleStateFiring},
+		{"resolved", ruleStateFiring, []float64{0, 0, 0}, ruleStateResolved},
+		{"resolved while latest breaches", ruleStateFiring, []float64{0, 0, 20}, ruleStateResolved},
+		{"ok after resolved", ruleStateResolved, []float64{0, 0, 0}, ruleStateOK},
+		{"pending after resolved", ruleStateResolved, []float64{0, 0, 20}, ruleStatePending},
+	}
+	for _, test := range tests {
+		got, err := NextRuleState(RuleState{State: test.state}, ">=10", test.values)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: NextRuleState(%s, %v) = %s, want %s", test.name, test.state, test.values, got, test.want)
+		}
+	}
+}
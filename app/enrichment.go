@@ -0,0 +1,406 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gin-zabbix/configs"
+	"gin-zabbix/connector"
+	"gin-zabbix/store"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 告警上下文：问题产生时重新执行告警的查询，按配置的字段统计命中最多的值并取几条示例日志，
+// 写入问题的确认消息，同时保存在本地供接口查询。
+
+const (
+	enrichmentStoreName = "enrichment"
+	// Zabbix 确认消息的长度上限
+	acknowledgeMessageLimit = 2048
+)
+
+type TermBucket struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+type Enrichment struct {
+	EventID   string                  `json:"event_id"`
+	TriggerID string                  `json:"trigger_id"`
+	Name      string                  `json:"name"`
+	Index     string                  `json:"index"`
+	Time      time.Time               `json:"time"`
+	Count     int64                   `json:"count"`
+	Top       map[string][]TermBucket `json:"top"`
+	Samples   []string                `json:"samples"`
+	// 集群配置了 kibana_url 时返回 Discover 链接
+	DiscoverURL string `json:"discover_url,omitempty"`
+}
+
+// BuildEnrichmentBody 在告警查询体的基础上按字段做 terms 聚合，并按时间倒序返回示例日志
+func BuildEnrichmentBody(posts, timestampField string, config configs.EnrichmentConfig) ([]byte, error) {
+	var body map[string]interface{}
+	err := json.Unmarshal([]byte(posts), &body)
+	if err != nil {
+		return nil, fmt.Errorf("解析查询体失败：%s", err.Error())
+	}
+	body["size"] = config.Samples
+	body["sort"] = []map[string]string{{timestampField: "desc"}}
+	body["_source"] = []string{config.MessageField}
+	aggs := map[string]interface{}{}
+	for _, field := range config.Fields {
+		aggs[field] = map[string]interface{}{
+			"terms": map[string]interface{}{
+				"field": field,
+				"size":  config.TopSize,
+			},
+		}
+	}
+	body["aggs"] = aggs
+	return json.Marshal(body)
+}
+
+// sourceValue 按点号分隔的路径读取 _source 中的字段，兼容扁平和嵌套两种写法
+func sourceValue(source map[string]interface{}, field string) interface{} {
+	if value, ok := source[field]; ok {
+		return value
+	}
+	parts := strings.SplitN(field, ".", 2)
+	if len(parts) < 2 {
+		return nil
+	}
+	child, ok := source[parts[0]].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return sourceValue(child, parts[1])
+}
+
+// Enrich 执行触发器所属告警的查询，生成告警上下文，kql 为创建告警时保存的原始 KQL
+func Enrich(config configs.Config, problem connector.Problem, trigger connector.Trigger, kql string) (Enrichment, error) {
+	if len(trigger.Items) == 0 {
+		return Enrichment{}, fmt.Errorf("触发器未引用监控项：%s", trigger.Description)
+	}
+	item := trigger.Items[0]
+	cluster, err := config.GetCluster(config.ClusterName(item.GetElasticsearch()))
+	if err != nil {
+		return Enrichment{}, err
+	}
+	if cluster.Backend == connector.BackendLoki {
+		return Enrichment{}, fmt.Errorf("Loki 告警暂不支持告警上下文：%s", trigger.Description)
+	}
+	es := connector.NewElasticsearch(cluster)
+	index := item.GetIndex()
+	timestampField := item.GetTimestampField()
+	if timestampField == "" {
+		timestampField = cluster.TimestampField
+	}
+	body, err := BuildEnrichmentBody(item.Posts, timestampField, config.Enrichment)
+	if err != nil {
+		return Enrichment{}, err
+	}
+	result, err := es.Search(index, body)
+	if err != nil {
+		return Enrichment{}, err
+	}
+
+	enrichment := Enrichment{
+		EventID:     problem.EventID,
+		TriggerID:   trigger.TriggerID,
+		Name:        trigger.Description,
+		Index:       index,
+		Time:        time.Now(),
+		Count:       result.Total,
+		Top:         map[string][]TermBucket{},
+		DiscoverURL: ItemDiscoverURL(cluster, item, kql),
+	}
+	for _, field := range config.Enrichment.Fields {
+		var terms struct {
+			Buckets []struct {
+				Key         interface{} `json:"key"`
+				KeyAsString string      `json:"key_as_string"`
+				DocCount    int64       `json:"doc_count"`
+			} `json:"buckets"`
+		}
+		err = json.Unmarshal(result.Aggregations[field], &terms)
+		if err != nil {
+			continue
+		}
+		for _, bucket := range terms.Buckets {
+			key := bucket.KeyAsString
+			if key == "" {
+				key = fmt.Sprint(bucket.Key)
+			}
+			enrichment.Top[field] = append(enrichment.Top[field], TermBucket{Key: key, Count: bucket.DocCount})
+		}
+	}
+	for _, hit := range result.Hits {
+		if message := sourceValue(hit.Source, config.Enrichment.MessageField); message != nil {
+			enrichment.Samples = append(enrichment.Samples, fmt.Sprint(message))
+		}
+	}
+	return enrichment, nil
+}
+
+// FormatEnrichment 生成写入确认消息的文本，超过 Zabbix 长度上限时截断
+func FormatEnrichment(enrichment Enrichment, fields []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "命中 %d 条日志\n", enrichment.Count)
+	if enrichment.DiscoverURL != "" {
+		fmt.Fprintf(&b, "Kibana: %s\n", enrichment.DiscoverURL)
+	}
+	for _, field := range fields {
+		buckets := enrichment.Top[field]
+		if len(buckets) == 0 {
+			continue
+		}
+		values := make([]string, 0, len(buckets))
+		for _, bucket := range buckets {
+			values = append(values, fmt.Sprintf("%s(%d)", bucket.Key, bucket.Count))
+		}
+		fmt.Fprintf(&b, "%s: %s\n", field, strings.Join(values, ", "))
+	}
+	if len(enrichment.Samples) > 0 {
+		b.WriteString("示例日志：\n")
+		for _, sample := range enrichment.Samples {
+			fmt.Fprintf(&b, "- %s\n", sample)
+		}
+	}
+	message := []rune(strings.TrimSpace(b.String()))
+	if len(message) > acknowledgeMessageLimit {
+		message = append(message[:acknowledgeMessageLimit-1], '…')
+	}
+	return string(message)
+}
+
+// enrichProblems 为 enrichments 中还没有的问题生成上下文并写入确认消息
+func enrichProblems(config configs.Config, zabbix *connector.Zabbix, problems []connector.Problem, enrichments map[string]Enrichment, kqlQueries map[string]string, trapperItems map[string]TrapperItem) {
+	var triggerIDs []string
+	for _, problem := range problems {
+		if _, ok := enrichments[problem.EventID]; !ok {
+			triggerIDs = append(triggerIDs, problem.ObjectID)
+		}
+	}
+	if len(triggerIDs) == 0 {
+		return
+	}
+	triggers, err := zabbix.GetTriggersWithItems(triggerIDs)
+	if err != nil {
+		log.Printf("获取触发器失败：%s", err.Error())
+		return
+	}
+	triggerByID := map[string]connector.Trigger{}
+	for _, trigger := range triggers {
+		for i := range trigger.Items {
+			FillTrapperItem(&trigger.Items[i], trapperItems)
+		}
+		triggerByID[trigger.TriggerID] = trigger
+	}
+
+	for _, problem := range problems {
+		if _, ok := enrichments[problem.EventID]; ok {
+			continue
+		}
+		trigger, ok := triggerByID[problem.ObjectID]
+		if !ok {
+			continue
+		}
+		var kql string
+		if len(trigger.Items) > 0 {
+			kql = ItemKQL(trigger.Items[0], kqlQueries)
+		}
+		enrichment, err := Enrich(config, problem, trigger, kql)
+		if err != nil {
+			log.Printf("生成告警上下文失败 %s：%s", problem.Name, err.Error())
+			continue
+		}
+		_, err = zabbix.AcknowledgeEvent(problem.EventID, FormatEnrichment(enrichment, config.Enrichment.Fields))
+		if err != nil {
+			log.Printf("写入确认消息失败 %s：%s", problem.Name, err.Error())
+			continue
+		}
+		enrichments[problem.EventID] = enrichment
+	}
+}
+
+func refreshEnrichments(config configs.Config, st *store.Store) {
+	zabbix := connector.NewZabbix(config.Zabbix.Url, config.Zabbix.Token)
+	problems, err := zabbix.GetProblems(nil)
+	if err != nil {
+		log.Printf("获取问题失败：%s", err.Error())
+		return
+	}
+
+	enrichments := map[string]Enrichment{}
+	err = st.Load(enrichmentStoreName, &enrichments)
+	if err != nil {
+		log.Printf("读取告警上下文失败：%s", err.Error())
+		return
+	}
+	// 只保留仍未恢复的问题
+	current := map[string]Enrichment{}
+	for _, problem := range problems {
+		if enrichment, ok := enrichments[problem.EventID]; ok {
+			current[problem.EventID] = enrichment
+		}
+	}
+
+	kqlQueries, err := LoadKQL(st)
+	if err != nil {
+		log.Printf("读取 KQL 失败：%s", err.Error())
+		return
+	}
+	trapperItems, err := LoadTrapperItems(st)
+	if err != nil {
+		log.Printf("读取 trapper 监控项失败：%s", err.Error())
+		return
+	}
+	enrichProblems(config, zabbix, problems, current, kqlQueries, trapperItems)
+
+	err = st.Save(enrichmentStoreName, current)
+	if err != nil {
+		log.Printf("保存告警上下文失败：%s", err.Error())
+	}
+}
+
+// RunEnrichment 按配置的周期为新产生的问题生成上下文并写入确认消息
+func RunEnrichment(config configs.Config, st *store.Store) {
+	interval, err := time.ParseDuration(config.Enrichment.Interval)
+	if err != nil {
+		log.Printf("告警上下文检查周期配置错误：%s", err.Error())
+		return
+	}
+	refreshEnrichments(config, st)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		refreshEnrichments(config, st)
+	}
+}
+
+type QueryEnrichmentParamQuery struct {
+	EventID string `form:"event_id" binding:"required"`
+}
+
+// QueryEnrichment
+// @Summary Query Enrichment
+// @Schemes http
+// @Description 查询问题的告警上下文：命中最多的字段值和示例日志，尚未生成时立即生成
+// @Tags alert
+// @Accept json
+// @Produce json
+// @Param event_id query string true "问题的事件 ID"
+// @Success 200 {string} Success
+// @Security BasicAuth
+// @Router /v1/alert/enrichment [get]
+func QueryEnrichment(c *gin.Context) {
+	var query QueryEnrichmentParamQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	config := c.MustGet("config").(configs.Config)
+	st := c.MustGet("store").(*store.Store)
+	zabbix := connector.NewZabbix(config.Zabbix.Url, config.Zabbix.Token)
+
+	enrichments := map[string]Enrichment{}
+	err := st.Load(enrichmentStoreName, &enrichments)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	if enrichment, ok := enrichments[query.EventID]; ok {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"error":  "",
+			"data":   enrichment,
+		})
+		return
+	}
+
+	problems, err := zabbix.GetProblems([]string{query.EventID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	if len(problems) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": "failure",
+			"error":  "问题不存在或已恢复",
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	triggers, err := zabbix.GetTriggersWithItems([]string{problems[0].ObjectID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	if len(triggers) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": "failure",
+			"error":  "触发器不存在",
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	kqlQueries, err := LoadKQL(st)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	trapperItems, err := LoadTrapperItems(st)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	var kql string
+	if len(triggers[0].Items) > 0 {
+		FillTrapperItem(&triggers[0].Items[0], trapperItems)
+		kql = ItemKQL(triggers[0].Items[0], kqlQueries)
+	}
+	enrichment, err := Enrich(config, problems[0], triggers[0], kql)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"error":  "",
+		"data":   enrichment,
+	})
+}
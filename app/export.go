@@ -0,0 +1,421 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"gin-zabbix/configs"
+	"gin-zabbix/connector"
+	"gin-zabbix/store"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 导出告警定义为 Watcher 或 ElastAlert 2 规则，由 Elastic Stack 自己执行
+
+const (
+	exportFormatWatcher    = "watcher"
+	exportFormatElastAlert = "elastalert"
+)
+
+type ExportAlertParamQuery struct {
+	Format  string `form:"format" binding:"required,oneof=watcher elastalert"`
+	Cluster string `form:"cluster"`
+	Index   string `form:"index"`
+	Name    string `form:"name"`
+}
+
+type InstallWatchParamQuery struct {
+	Cluster string `form:"cluster"`
+	Index   string `form:"index"`
+	Name    string `form:"name"`
+}
+
+type ExportResult struct {
+	// watch ID 或 ElastAlert 规则文件名（不含扩展名）
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Cluster string `json:"cluster"`
+	Index   string `json:"index"`
+	Status  string `json:"status"`
+	Error   string `json:"error"`
+	// Watcher 为 JSON 对象，ElastAlert 为 YAML 文本
+	Content interface{} `json:"content,omitempty" swaggertype:"object"`
+}
+
+// LoadAlerts 返回全部告警，内置引擎读取本地保存的告警和状态；Zabbix 模式下一次 item.get 取出全部监控项
+// 及其触发器，再一次取出全部组合触发器，不逐个监控项查询
+func LoadAlerts(config configs.Config, st *store.Store) ([]Alert, error) {
+	if config.Alerting.Backend == alertingInternal {
+		rules, err := LoadRules(st)
+		if err != nil {
+			return nil, err
+		}
+		states, err := LoadRuleStates(st)
+		if err != nil {
+			return nil, err
+		}
+		alerts := make([]Alert, 0, len(rules))
+		for id, rule := range rules {
+			var state *RuleState
+			if s, ok := states[id]; ok {
+				state = &s
+			}
+			alerts = append(alerts, RuleAlert(config, rule, state))
+		}
+		return alerts, nil
+	}
+
+	zabbix := connector.NewZabbix(config.Zabbix.Url, config.Zabbix.Token)
+	items, err := zabbix.GetItems()
+	if err != nil {
+		return nil, err
+	}
+	triggers, err := zabbix.GetCompositeTriggers(nil)
+	if err != nil {
+		return nil, err
+	}
+	composites := map[string][]string{}
+	for _, trigger := range triggers {
+		for _, item := range trigger.Items {
+			composites[item.ItemID] = append(composites[item.ItemID], trigger.Description)
+		}
+	}
+	kqlQueries, err := LoadKQL(st)
+	if err != nil {
+		return nil, err
+	}
+	trapperItems, err := LoadTrapperItems(st)
+	if err != nil {
+		return nil, err
+	}
+	trapperStatus, err := LoadTrapperStatus(st)
+	if err != nil {
+		return nil, err
+	}
+	alerts := make([]Alert, 0, len(items))
+	for i := range items {
+		FillTrapperItem(&items[i], trapperItems)
+		cluster := config.ClusterName(items[i].GetElasticsearch())
+		alert := ItemAlert(config, cluster, items[i], kqlQueries[items[i].ItemID])
+		if names, ok := composites[items[i].ItemID]; ok {
+			alert.Composites = names
+		}
+		if status, ok := trapperStatus[items[i].ItemID]; ok {
+			alert.Trapper = &status
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+// filterAlerts 按集群、索引和名称筛选告警，条件为空时不筛选
+func filterAlerts(alerts []Alert, cluster, index, name string) []Alert {
+	if cluster == "" {
+		cluster = configs.DefaultCluster
+	}
+	var filtered []Alert
+	for _, alert := range alerts {
+		if alert.Cluster != cluster || index != "" && alert.Index != index || name != "" && alert.Name != name {
+			continue
+		}
+		filtered = append(filtered, alert)
+	}
+	return filtered
+}
+
+// ExportID 导出的 watch ID 和规则文件名，与告警所在主机和监控项 key 对应
+func ExportID(alert Alert) string {
+	return strings.ToLower(strings.ReplaceAll(alert.HostName, " ", "_")) + "-" + alert.Key
+}
+
+// ExportDefinition 将告警转换为导出定义，Loki 告警和动态基线告警无法导出
+func ExportDefinition(config configs.Config, alert Alert) (connector.ExportDefinition, error) {
+	cluster, err := config.GetCluster(alert.Cluster)
+	if err != nil {
+		return connector.ExportDefinition{}, err
+	}
+	if cluster.Backend == connector.BackendLoki {
+		return connector.ExportDefinition{}, errors.New("Loki 告警无法导出到 Elastic Stack")
+	}
+	flavor, err := connector.ParseFlavor(cluster.Flavor)
+	if err != nil {
+		return connector.ExportDefinition{}, err
+	}
+	op, number := SplitThreshold(alert.Threshold)
+	value, err := strconv.ParseFloat(number, 64)
+	if op == "" || err != nil {
+		return connector.ExportDefinition{}, fmt.Errorf("阈值无法导出（动态基线告警不支持导出）：%s", alert.Threshold)
+	}
+
+	query := alert.Query
+	if len(query) == 0 {
+		query, err = json.Marshal(map[string]interface{}{
+			"query_string": map[string]string{"query": alert.QueryString},
+		})
+		if err != nil {
+			return connector.ExportDefinition{}, fmt.Errorf("JSON编码失败：%s", err.Error())
+		}
+	}
+	timestampField := alert.TimestampField
+	if timestampField == "" {
+		timestampField = cluster.TimestampField
+	}
+	// Zabbix 的检查周期可以是纯数字秒数
+	interval := alert.Delay
+	if _, err := strconv.Atoi(interval); err == nil {
+		interval += "s"
+	}
+	return connector.ExportDefinition{
+		Name:           alert.Name,
+		Description:    alert.Description,
+		Index:          alert.Index,
+		Query:          query,
+		TimestampField: timestampField,
+		Window:         alert.Window,
+		Lag:            alert.Lag,
+		Interval:       interval,
+		Operator:       op,
+		Value:          value,
+		Flavor:         flavor,
+	}, nil
+}
+
+// ExportAlerts 按格式导出告警，单个告警失败时记录在结果中，不影响其他告警
+func ExportAlerts(config configs.Config, alerts []Alert, format string) []ExportResult {
+	results := make([]ExportResult, 0, len(alerts))
+	for _, alert := range alerts {
+		result := ExportResult{
+			ID:      ExportID(alert),
+			Name:    alert.Name,
+			Cluster: alert.Cluster,
+			Index:   alert.Index,
+			Status:  "failure",
+		}
+		def, err := ExportDefinition(config, alert)
+		if err == nil {
+			if format == exportFormatWatcher {
+				result.Content, err = connector.Watch(def)
+			} else {
+				result.Content, err = connector.ElastAlert(def)
+			}
+		}
+		if err != nil {
+			result.Error = err.Error()
+			result.Content = nil
+		} else {
+			result.Status = "success"
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// InstallWatches 将导出的 watch 写入告警所在的集群，返回失败的数量
+func InstallWatches(config configs.Config, results []ExportResult) int {
+	failed := 0
+	for i := range results {
+		if results[i].Status != "success" {
+			failed++
+			continue
+		}
+		cluster, err := config.GetCluster(results[i].Cluster)
+		if err == nil {
+			err = connector.NewElasticsearch(cluster).PutWatch(results[i].ID, results[i].Content.(json.RawMessage))
+		}
+		if err != nil {
+			results[i].Status = "failure"
+			results[i].Error = err.Error()
+			failed++
+		}
+	}
+	return failed
+}
+
+// ExportAlert
+// @Summary Export Alerts
+// @Schemes http
+// @Description 将告警导出为 Elasticsearch Watcher JSON 或 ElastAlert 2 规则 YAML
+// @Tags alert
+// @Accept json
+// @Produce json
+// @Param format query string true "watcher 或 elastalert"
+// @Param cluster query string false "Elasticsearch 集群名称，默认为 default"
+// @Param index query string false "索引，为空时导出集群的全部告警"
+// @Param name query string false "名称"
+// @Success 200 {string} Success
+// @Security BasicAuth
+// @Router /v1/alert/export [get]
+func ExportAlert(c *gin.Context) {
+	var query ExportAlertParamQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	config := c.MustGet("config").(configs.Config)
+	st := c.MustGet("store").(*store.Store)
+	alerts, err := LoadAlerts(config, st)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	results := ExportAlerts(config, filterAlerts(alerts, query.Cluster, query.Index, query.Name), query.Format)
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"error":  "",
+		"data":   results,
+	})
+}
+
+// InstallWatch
+// @Summary Install Watches
+// @Schemes http
+// @Description 将告警导出为 Watcher 并通过 _watcher API 写入告警所在的集群，已存在的 watch 会被更新
+// @Tags alert
+// @Accept json
+// @Produce json
+// @Param cluster query string false "Elasticsearch 集群名称，默认为 default"
+// @Param index query string false "索引，为空时写入集群的全部告警"
+// @Param name query string false "名称"
+// @Success 200 {string} Success
+// @Security BasicAuth
+// @Router /v1/alert/export/watcher [post]
+func InstallWatch(c *gin.Context) {
+	var query InstallWatchParamQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	config := c.MustGet("config").(configs.Config)
+	st := c.MustGet("store").(*store.Store)
+	alerts, err := LoadAlerts(config, st)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	alerts = filterAlerts(alerts, query.Cluster, query.Index, query.Name)
+	if len(alerts) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": "failure",
+			"error":  "没有匹配的告警",
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	results := ExportAlerts(config, alerts, exportFormatWatcher)
+	failed := InstallWatches(config, results)
+	switch {
+	case failed == 0:
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"error":  "",
+			"data":   results,
+		})
+	case failed == len(results):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  results[0].Error,
+			"data":   results,
+		})
+	default:
+		c.JSON(http.StatusMultiStatus, gin.H{
+			"status": "failure",
+			"error":  fmt.Sprintf("%d 个 watch 写入失败", failed),
+			"data":   results,
+		})
+	}
+}
+
+// RunExportCommand export 子命令：导出告警到标准输出或目录，-install 时写入 Watcher
+func RunExportCommand(config configs.Config, st *store.Store, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", exportFormatWatcher, "导出格式：watcher 或 elastalert")
+	cluster := flags.String("cluster", "", "Elasticsearch 集群名称，默认为 default")
+	index := flags.String("index", "", "索引，为空时导出集群的全部告警")
+	name := flags.String("name", "", "告警名称")
+	out := flags.String("out", "", "输出目录，每个告警一个文件，为空时输出到标准输出")
+	install := flags.Bool("install", false, "通过 _watcher API 写入告警所在的集群，只支持 watcher 格式")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *format != exportFormatWatcher && *format != exportFormatElastAlert {
+		return fmt.Errorf("不支持的导出格式：%s", *format)
+	}
+	if *install && *format != exportFormatWatcher {
+		return errors.New("-install 只支持 watcher 格式")
+	}
+
+	alerts, err := LoadAlerts(config, st)
+	if err != nil {
+		return err
+	}
+	results := ExportAlerts(config, filterAlerts(alerts, *cluster, *index, *name), *format)
+	if *install {
+		InstallWatches(config, results)
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Status != "success" {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s：%s\n", result.ID, result.Error)
+			continue
+		}
+		if *install {
+			fmt.Fprintf(os.Stderr, "%s：已写入\n", result.ID)
+			continue
+		}
+		content, extension := "", ".yaml"
+		if *format == exportFormatWatcher {
+			data, err := json.MarshalIndent(result.Content, "", "  ")
+			if err != nil {
+				return fmt.Errorf("JSON编码失败：%s", err.Error())
+			}
+			content, extension = string(data)+"\n", ".json"
+		} else {
+			content = result.Content.(string)
+		}
+		if *out == "" {
+			// ElastAlert 规则之间以 YAML 文档分隔符分开，watch 依次输出
+			if *format == exportFormatElastAlert {
+				fmt.Print("---\n")
+			}
+			fmt.Print(content)
+			continue
+		}
+		err := os.WriteFile(filepath.Join(*out, result.ID+extension), []byte(content), 0644)
+		if err != nil {
+			return fmt.Errorf("写入文件失败：%s", err.Error())
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个告警导出失败", failed)
+	}
+	return nil
+}
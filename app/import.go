@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gin-zabbix/configs"
+	"gin-zabbix/connector"
+	"gin-zabbix/store"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+type ImportAlertParamBody struct {
+	CreatAlertParamBody
+	// Saved Objects 导出的 NDJSON，与 discover_url 二选一，其中的每个已保存搜索创建一个告警
+	NDJSON string `json:"ndjson"`
+	// Discover 链接，未指定 window 时使用链接中 now-15m 形式的时间范围作为统计窗口
+	DiscoverURL string `json:"discover_url" example:"https://127.0.0.1:5601/app/discover#/?_a=(index:'logs-*',query:(language:kuery,query:'level:error'))"`
+}
+
+type ImportAlertParamQuery struct {
+	// 为空时使用已保存搜索的标题，导入多个已保存搜索时不能指定
+	Name string `form:"name"`
+	// 为空时使用已保存搜索的索引模式
+	Index   string `form:"index"`
+	Cluster string `form:"cluster"`
+}
+
+type ImportResult struct {
+	Name   string                 `json:"name"`
+	Index  string                 `json:"index"`
+	Status string                 `json:"status"`
+	Error  string                 `json:"error"`
+	Data   map[string]interface{} `json:"data"`
+}
+
+// SavedSearchQuery 将已保存搜索转换为创建告警的查询：没有过滤条件时保留 KQL 或 Lucene 查询语句，
+// 否则与过滤条件一起组合为查询 DSL
+func SavedSearchQuery(search connector.SavedSearch) (string, string, json.RawMessage, error) {
+	if len(search.Filters) == 0 {
+		if search.Query == "" {
+			return queryLanguageLucene, "*", nil, nil
+		}
+		if search.Language == "kuery" {
+			return queryLanguageKQL, search.Query, nil, nil
+		}
+		return queryLanguageLucene, search.Query, nil, nil
+	}
+
+	var clauses []json.RawMessage
+	if search.Query != "" {
+		var clause json.RawMessage
+		var err error
+		if search.Language == "kuery" {
+			clause, err = connector.ParseKQL(search.Query)
+		} else {
+			clause, err = json.Marshal(map[string]interface{}{
+				"query_string": map[string]string{"query": search.Query},
+			})
+		}
+		if err != nil {
+			return "", "", nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	clauses = append(clauses, search.Filters...)
+	dsl, err := json.Marshal(map[string]interface{}{
+		"bool": map[string]interface{}{"filter": clauses},
+	})
+	if err != nil {
+		return "", "", nil, fmt.Errorf("JSON编码失败：%s", err.Error())
+	}
+	return "", "", dsl, nil
+}
+
+// importSavedSearch 按已保存搜索创建告警，与 CreatAlert 走同一流程
+func importSavedSearch(config configs.Config, st *store.Store, query ImportAlertParamQuery, body ImportAlertParamBody, search connector.SavedSearch) ImportResult {
+	result := ImportResult{Name: query.Name, Index: query.Index, Status: "failure", Data: map[string]interface{}{}}
+	if result.Name == "" {
+		result.Name = search.Title
+	}
+	if result.Name == "" {
+		result.Error = "已保存搜索没有标题，请通过 name 参数指定告警名称"
+		return result
+	}
+	cluster, err := config.GetCluster(query.Cluster)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if result.Index == "" {
+		result.Index = search.Index
+	}
+	if result.Index == "" {
+		result.Index = DataViewIndex(cluster, search.DataView)
+	}
+	if result.Index == "" {
+		result.Error = "无法确定索引模式，请通过 index 参数指定"
+		return result
+	}
+
+	queryLanguage, queryString, dsl, err := SavedSearchQuery(search)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	alertBody := body.CreatAlertParamBody
+	alertBody.QueryLanguage = queryLanguage
+	alertBody.Query = dsl
+	if alertBody.Window == "" && search.To == "now" {
+		if window := strings.TrimPrefix(search.From, "now-"); durationPattern.MatchString(window) {
+			alertBody.Window = window
+		}
+	}
+	alertQuery := CreatAlertParamQuery{
+		Name:        result.Name,
+		Index:       result.Index,
+		QueryString: queryString,
+		Cluster:     query.Cluster,
+	}
+
+	data, _, err := CreateAlert(config, st, alertQuery, alertBody)
+	if data != nil {
+		result.Data = data
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Status = "success"
+	return result
+}
+
+// ImportAlert
+// @Summary Import Alert
+// @Schemes http
+// @Description 从 Kibana 已保存搜索（Saved Objects 导出的 NDJSON）或 Discover 链接创建告警，提取索引模式、查询语句和过滤条件
+// @Tags alert
+// @Accept json
+// @Produce json
+// @Param name query string false "名称，默认为已保存搜索的标题"
+// @Param index query string false "索引，默认为已保存搜索的索引模式"
+// @Param cluster query string false "Elasticsearch 集群名称，默认为 default"
+// @Param request body ImportAlertParamBody true "导入配置"
+// @Success 200 {string} Success
+// @Security BasicAuth
+// @Router /v1/alert/import [post]
+func ImportAlert(c *gin.Context) {
+	var body ImportAlertParamBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	var query ImportAlertParamQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	if (body.NDJSON == "") == (body.DiscoverURL == "") {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  "ndjson 和 discover_url 必须且只能提供一个",
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	config := c.MustGet("config").(configs.Config)
+	st := c.MustGet("store").(*store.Store)
+
+	var searches []connector.SavedSearch
+	if body.NDJSON != "" {
+		parsed, err := connector.ParseSavedSearches(body.NDJSON)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"status": "failure",
+				"error":  err.Error(),
+				"data":   map[string]interface{}{},
+			})
+			return
+		}
+		searches = parsed
+	} else {
+		search, err := connector.ParseDiscoverURL(body.DiscoverURL)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"status": "failure",
+				"error":  err.Error(),
+				"data":   map[string]interface{}{},
+			})
+			return
+		}
+		searches = []connector.SavedSearch{search}
+	}
+	if len(searches) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  "NDJSON 中没有已保存搜索",
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	if len(searches) > 1 && query.Name != "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  "导入多个已保存搜索时不能指定 name",
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	results := make([]ImportResult, 0, len(searches))
+	failed := 0
+	for _, search := range searches {
+		result := importSavedSearch(config, st, query, body, search)
+		if result.Status != "success" {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	switch {
+	case failed == 0:
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"error":  "",
+			"data":   results,
+		})
+	case failed == len(results):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  results[0].Error,
+			"data":   results,
+		})
+	default:
+		c.JSON(http.StatusMultiStatus, gin.H{
+			"status": "failure",
+			"error":  fmt.Sprintf("%d 个已保存搜索导入失败", failed),
+			"data":   results,
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gin-zabbix/configs"
+	"gin-zabbix/connector"
+)
+
+// triggerURLLimit Zabbix 6.0 触发器 url 字段的长度上限，超出时写入触发器说明
+const triggerURLLimit = 255
+
+// triggerLink 返回写入触发器 url 和说明（comments）的 Discover 链接：
+// 链接超过 url 字段上限时改为写入说明，并返回一条警告
+func triggerLink(discoverURL string) (string, string, []LintIssue) {
+	if len(discoverURL) <= triggerURLLimit {
+		return discoverURL, "", nil
+	}
+	return "", "Kibana Discover: " + discoverURL, []LintIssue{{
+		Rule:    "long_discover_url",
+		Message: fmt.Sprintf("Discover 链接长度 %d 超过触发器 url 字段上限 %d，已写入触发器说明", len(discoverURL), triggerURLLimit),
+	}}
+}
+
+// AlertDiscoverURL 生成与告警统计区间一致的 Kibana Discover 链接，集群未配置 Kibana 时返回空字符串
+func AlertDiscoverURL(cluster configs.ElasticsearchConfig, index, queryLanguage, queryString string, query json.RawMessage, window, lag string) string {
+	if cluster.KibanaUrl == "" {
+		return ""
+	}
+	dataView, ok := cluster.KibanaDataViews[index]
+	if !ok {
+		dataView = index
+	}
+	to := "now"
+	if lag != "" {
+		to = fmt.Sprintf("now-%s", lag)
+	}
+	options := connector.DiscoverOptions{
+		DataView: dataView,
+		Language: "lucene",
+		Query:    queryString,
+		From:     fmt.Sprintf("%s-%s", to, window),
+		To:       to,
+	}
+	switch queryLanguage {
+	case queryLanguageKQL:
+		options.Language = "kuery"
+	case queryLanguageDSL:
+		options.Query = ""
+		options.Filter = query
+	}
+	return connector.DiscoverURL(cluster.KibanaUrl, options)
+}
+
+// ItemDiscoverURL 根据监控项的查询体生成 Discover 链接，kql 为创建时保存的原始 KQL
+func ItemDiscoverURL(cluster configs.ElasticsearchConfig, item connector.Item, kql string) string {
+	if kql != "" {
+		return AlertDiscoverURL(cluster, item.GetIndex(), queryLanguageKQL, kql, nil, item.GetWindow(), item.GetLag())
+	}
+	if item.IsDSL() {
+		return AlertDiscoverURL(cluster, item.GetIndex(), queryLanguageDSL, "", item.GetQuery(), item.GetWindow(), item.GetLag())
+	}
+	return AlertDiscoverURL(cluster, item.GetIndex(), queryLanguageLucene, item.GetQueryString(), nil, item.GetWindow(), item.GetLag())
+}
+
+// DataViewIndex 根据 kibana_data_views 由数据视图 ID 反查索引模式，未配置时 ID 即索引模式
+func DataViewIndex(cluster configs.ElasticsearchConfig, dataView string) string {
+	for index, id := range cluster.KibanaDataViews {
+		if id == dataView {
+			return index
+		}
+	}
+	return dataView
+}
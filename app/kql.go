@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gin-zabbix/connector"
+	"gin-zabbix/store"
+	"strings"
+)
+
+// KQL 告警：创建时将 query_string 中的 KQL 翻译为查询 DSL 写入监控项，
+// 原始 KQL 附在监控项描述之后保存在 Zabbix 中，查询告警时原样返回；
+// 本地按监控项 ID 保存的 KQL 只作为缓存，供描述中没有 KQL 的旧监控项使用。
+
+const (
+	queryLanguageTag    = "query_language"
+	queryLanguageKQL    = "kql"
+	queryLanguageDSL    = "dsl"
+	queryLanguageLucene = "lucene"
+	kqlStoreName        = "kql"
+	// kqlDescriptionSeparator 监控项描述中用户描述与原始 KQL 之间的分隔行
+	kqlDescriptionSeparator = "\n\n--- KQL ---\n"
+)
+
+// KQLDescription 将原始 KQL 附在监控项描述之后，kql 为空时原样返回描述
+func KQLDescription(description, kql string) string {
+	if kql == "" {
+		return description
+	}
+	return description + kqlDescriptionSeparator + kql
+}
+
+// SplitKQLDescription 将监控项描述拆分为用户描述和原始 KQL，描述中没有 KQL 时 kql 为空
+func SplitKQLDescription(description string) (string, string) {
+	i := strings.LastIndex(description, kqlDescriptionSeparator)
+	if i < 0 {
+		return description, ""
+	}
+	return description[:i], description[i+len(kqlDescriptionSeparator):]
+}
+
+// ItemKQL 返回监控项的原始 KQL：优先读取监控项描述，没有时使用本地缓存
+func ItemKQL(item connector.Item, cached map[string]string) string {
+	_, kql := SplitKQLDescription(item.Description)
+	if kql != "" {
+		return kql
+	}
+	return cached[item.ItemID]
+}
+
+// TranslateQuery query_language 为 kql 时将 query_string 翻译为查询 DSL，其余情况原样返回
+func TranslateQuery(queryLanguage, queryString string, query json.RawMessage) (string, json.RawMessage, error) {
+	if queryLanguage != queryLanguageKQL || queryString == "" {
+		return queryString, query, nil
+	}
+	if len(query) > 0 {
+		return "", nil, fmt.Errorf("query_language 为 kql 时只能使用 query_string")
+	}
+	dsl, err := connector.ParseKQL(queryString)
+	if err != nil {
+		return "", nil, err
+	}
+	return "", dsl, nil
+}
+
+// SaveKQL 保存监控项对应的原始 KQL
+func SaveKQL(st *store.Store, itemID, kql string) error {
+	queries := map[string]string{}
+	return st.Update(kqlStoreName, &queries, func() error {
+		queries[itemID] = kql
+		return nil
+	})
+}
+
+// DeleteKQL 删除监控项对应的原始 KQL，不存在时不做任何操作
+func DeleteKQL(st *store.Store, itemID string) error {
+	queries := map[string]string{}
+	return st.Update(kqlStoreName, &queries, func() error {
+		delete(queries, itemID)
+		return nil
+	})
+}
+
+// LoadKQL 返回所有监控项 ID 到原始 KQL 的映射
+func LoadKQL(st *store.Store) (map[string]string, error) {
+	queries := map[string]string{}
+	err := st.Load(kqlStoreName, &queries)
+	if err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"gin-zabbix/connector"
+	"testing"
+)
+
+func TestKQLDescriptionRoundTrip(t *testing.T) {
+	tests := []struct {
+		description string
+		kql         string
+	}{
+		{"errors in checkout", "service.name:checkout and level:error"},
+		{"", "message:\"a\nb\""},
+		{"multi\n\nline", "not status:200"},
+		{"no kql", ""},
+	}
+	for _, test := range tests {
+		description, kql := SplitKQLDescription(KQLDescription(test.description, test.kql))
+		if description != test.description || kql != test.kql {
+			t.Errorf("SplitKQLDescription() = %q, %q, want %q, %q", description, kql, test.description, test.kql)
+		}
+	}
+}
+
+func TestItemKQL(t *testing.T) {
+	cached := map[string]string{"1": "cached:1", "2": "cached:2"}
+	item := connector.Item{ItemID: "1", Description: KQLDescription("desc", "stored:1")}
+	if got := ItemKQL(item, cached); got != "stored:1" {
+		t.Errorf("ItemKQL() = %q, want the KQL stored on the item", got)
+	}
+	item = connector.Item{ItemID: "2", Description: "desc"}
+	if got := ItemKQL(item, cached); got != "cached:2" {
+		t.Errorf("ItemKQL() = %q, want the cached KQL", got)
+	}
+	item = connector.Item{ItemID: "3", Description: KQLDescription("desc", "stored:3")}
+	if got := ItemKQL(item, nil); got != "stored:3" {
+		t.Errorf("ItemKQL() = %q, want the KQL stored on the item without a cache", got)
+	}
+}
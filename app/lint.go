@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gin-zabbix/configs"
+	"gin-zabbix/connector"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 查询检查：创建告警前找出代价较高的写法，按 lint.policy 返回警告或拒绝创建。
+
+const (
+	lintPolicyDeny = "deny"
+	lintPolicyOff  = "off"
+)
+
+type LintIssue struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type CostEstimate struct {
+	connector.ProfileResult
+	RunsPerDay int64 `json:"runs_per_day"`
+	// 按检查周期估算的每天查询耗时
+	DailyQueryMillis float64 `json:"daily_query_ms"`
+}
+
+// LintQuery 检查 query_string 和查询 DSL 中的前导通配符和无边界正则表达式
+func LintQuery(queryString string, query json.RawMessage) []LintIssue {
+	issues := lintLucene(queryString)
+	if len(query) > 0 {
+		var node interface{}
+		err := json.Unmarshal(query, &node)
+		if err == nil {
+			issues = append(issues, lintDSL(node)...)
+		}
+	}
+	return issues
+}
+
+// LintSchedule 检查统计窗口是否过大、检查周期是否过短，无法解析的值不检查
+func LintSchedule(interval, window string, config configs.LintConfig) []LintIssue {
+	var issues []LintIssue
+	windowDuration, err := connector.ParseDuration(window)
+	maxWindow, maxErr := connector.ParseDuration(config.MaxWindow)
+	if err == nil && maxErr == nil && windowDuration > maxWindow {
+		issues = append(issues, LintIssue{
+			Rule:    "large_window",
+			Message: fmt.Sprintf("统计窗口 %s 超过上限 %s", window, config.MaxWindow),
+		})
+	}
+	intervalDuration, err := connector.ParseDuration(interval)
+	minInterval, minErr := connector.ParseDuration(config.MinInterval)
+	if err == nil && minErr == nil && intervalDuration < minInterval {
+		issues = append(issues, LintIssue{
+			Rule:    "short_interval",
+			Message: fmt.Sprintf("检查周期 %s 小于下限 %s", interval, config.MinInterval),
+		})
+	}
+	return issues
+}
+
+// FormatLintIssues 将检查结果拼接为一条错误信息
+func FormatLintIssues(issues []LintIssue) string {
+	messages := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		messages = append(messages, issue.Message)
+	}
+	return fmt.Sprintf("查询未通过检查：%s", strings.Join(messages, "；"))
+}
+
+// EstimateCost 执行一次带 profile 的查询，按检查周期估算每天的查询耗时
+func EstimateCost(es *connector.Elasticsearch, index, posts, interval string) (CostEstimate, error) {
+	profile, err := es.Profile(index, []byte(posts))
+	if err != nil {
+		return CostEstimate{}, err
+	}
+	estimate := CostEstimate{ProfileResult: profile}
+	duration, err := connector.ParseDuration(interval)
+	if err == nil {
+		estimate.RunsPerDay = int64(24 * time.Hour / duration)
+		estimate.DailyQueryMillis = profile.QueryMillis * float64(estimate.RunsPerDay)
+	}
+	return estimate, nil
+}
+
+func leadingWildcard(term string) bool {
+	return term != "*" && (strings.HasPrefix(term, "*") || strings.HasPrefix(term, "?"))
+}
+
+// unboundedRegex Lucene 正则表达式隐含首尾锚定，以 .* 或 .+ 开头时需要扫描全部词项
+func unboundedRegex(regex string) bool {
+	regex = strings.TrimLeft(regex, "(")
+	return strings.HasPrefix(regex, ".*") || strings.HasPrefix(regex, ".+")
+}
+
+// lintLucene 逐个词项扫描 Lucene 查询语句，跳过转义字符、短语和范围
+func lintLucene(query string) []LintIssue {
+	var issues []LintIssue
+	runes := []rune(query)
+	// readUntil 从 start 开始读到 end 字符为止，返回读到的内容和结束位置
+	readUntil := func(start int, end rune) (string, int) {
+		i := start
+		for i < len(runes) && runes[i] != end {
+			if runes[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i > len(runes) {
+			i = len(runes)
+		}
+		return string(runes[start:i]), i
+	}
+	termStart := true
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\':
+			i++
+			termStart = false
+		case unicode.IsSpace(r) || r == '(' || r == ')' || r == ':':
+			termStart = true
+		case r == '[' || r == '{':
+			_, i = readUntil(i+1, map[rune]rune{'[': ']', '{': '}'}[r])
+			termStart = false
+		case termStart && (r == '+' || r == '-' || r == '!'):
+		case termStart && r == '"':
+			_, i = readUntil(i+1, '"')
+			termStart = false
+		case termStart && r == '/':
+			var regex string
+			regex, i = readUntil(i+1, '/')
+			if unboundedRegex(regex) {
+				issues = append(issues, LintIssue{
+					Rule:    "unbounded_regex",
+					Message: fmt.Sprintf("以 .* 或 .+ 开头的正则表达式需要扫描全部词项：/%s/", regex),
+				})
+			}
+			termStart = false
+		case termStart && (r == '*' || r == '?'):
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != ')' {
+				end++
+			}
+			term := string(runes[i:end])
+			if leadingWildcard(term) {
+				issues = append(issues, LintIssue{
+					Rule:    "leading_wildcard",
+					Message: fmt.Sprintf("前导通配符需要扫描全部词项：%s", term),
+				})
+			}
+			i = end - 1
+			termStart = false
+		default:
+			termStart = false
+		}
+	}
+	return issues
+}
+
+// lintDSL 递归检查查询 DSL 中的 wildcard、regexp 以及嵌套的 query_string
+func lintDSL(node interface{}) []LintIssue {
+	var issues []LintIssue
+	switch v := node.(type) {
+	case []interface{}:
+		for _, child := range v {
+			issues = append(issues, lintDSL(child)...)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			switch key {
+			case "wildcard":
+				for field, pattern := range dslPatterns(v[key], "value", "wildcard") {
+					if leadingWildcard(pattern) {
+						issues = append(issues, LintIssue{
+							Rule:    "leading_wildcard",
+							Message: fmt.Sprintf("前导通配符需要扫描全部词项：%s:%s", field, pattern),
+						})
+					}
+				}
+				continue
+			case "regexp":
+				for field, pattern := range dslPatterns(v[key], "value") {
+					if unboundedRegex(pattern) {
+						issues = append(issues, LintIssue{
+							Rule:    "unbounded_regex",
+							Message: fmt.Sprintf("以 .* 或 .+ 开头的正则表达式需要扫描全部词项：%s:/%s/", field, pattern),
+						})
+					}
+				}
+				continue
+			case "query_string":
+				if clause, ok := v[key].(map[string]interface{}); ok {
+					if query, ok := clause["query"].(string); ok {
+						issues = append(issues, lintLucene(query)...)
+					}
+				}
+				continue
+			}
+			issues = append(issues, lintDSL(v[key])...)
+		}
+	}
+	return issues
+}
+
+// dslPatterns 返回 wildcard、regexp 查询中字段到模式的映射，支持简写和对象两种写法
+func dslPatterns(clause interface{}, names ...string) map[string]string {
+	patterns := map[string]string{}
+	fields, ok := clause.(map[string]interface{})
+	if !ok {
+		return patterns
+	}
+	for field, value := range fields {
+		switch v := value.(type) {
+		case string:
+			patterns[field] = v
+		case map[string]interface{}:
+			for _, name := range names {
+				if pattern, ok := v[name].(string); ok {
+					patterns[field] = pattern
+					break
+				}
+			}
+		}
+	}
+	return patterns
+}
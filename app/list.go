@@ -0,0 +1,221 @@
+package main
+
+import (
+	"gin-zabbix/configs"
+	"gin-zabbix/connector"
+	"gin-zabbix/store"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 告警列表：跨索引和集群列出全部告警，支持筛选、排序和分页
+
+type ListAlertsParamQuery struct {
+	Page     int `form:"page,default=1" binding:"min=1"`
+	PageSize int `form:"page_size,default=50" binding:"min=1,max=500"`
+	// 排序字段：name、index、cluster、delay、threshold 或 id
+	Sort  string `form:"sort,default=name" binding:"oneof=name index cluster delay threshold id"`
+	Order string `form:"order,default=asc" binding:"oneof=asc desc"`
+	// 集群名称，为空时列出全部集群
+	Cluster     string `form:"cluster"`
+	IndexPrefix string `form:"index_prefix"`
+	// 名称包含的文本，不区分大小写
+	Name string `form:"name"`
+	// 阈值，如 >=10，忽略空格
+	Threshold string `form:"threshold"`
+	// 检查周期，1m 与 60s 视为相同
+	Delay string `form:"delay"`
+	// 监控项标签，tag 或 tag:value
+	Tag     string `form:"tag"`
+	Enabled *bool  `form:"enabled"`
+	Firing  *bool  `form:"firing"`
+}
+
+// AlertListResponse 告警列表的一页
+type AlertListResponse struct {
+	Data []Alert `json:"data"`
+	// 满足筛选条件的告警总数
+	Total    int `json:"total"`
+	Page     int `json:"page"`
+	PageSize int `json:"page_size"`
+}
+
+// sameDelay 检查周期都能解析时按时长比较，否则按原文比较
+func sameDelay(a, b string) bool {
+	da, errA := connector.ParseDuration(a)
+	db, errB := connector.ParseDuration(b)
+	if errA == nil && errB == nil {
+		return da == db
+	}
+	return a == b
+}
+
+func hasTag(alert Alert, tag string) bool {
+	name, value, withValue := strings.Cut(tag, ":")
+	for _, t := range alert.Tags {
+		if t.Tag == name && (!withValue || t.Value == value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAlert 告警是否满足全部筛选条件
+func matchAlert(alert Alert, query ListAlertsParamQuery) bool {
+	spaces := strings.NewReplacer(" ", "")
+	switch {
+	case query.Cluster != "" && alert.Cluster != query.Cluster:
+		return false
+	case !strings.HasPrefix(alert.Index, query.IndexPrefix):
+		return false
+	case query.Name != "" && !strings.Contains(strings.ToLower(alert.Name), strings.ToLower(query.Name)):
+		return false
+	case query.Threshold != "" && spaces.Replace(alert.Threshold) != spaces.Replace(query.Threshold):
+		return false
+	case query.Delay != "" && !sameDelay(alert.Delay, query.Delay):
+		return false
+	case query.Tag != "" && !hasTag(alert, query.Tag):
+		return false
+	case query.Enabled != nil && alert.Enabled != *query.Enabled:
+		return false
+	case query.Firing != nil && alert.Firing != *query.Firing:
+		return false
+	}
+	return true
+}
+
+// lessAlert 按排序字段比较，相同时按名称（不区分大小写）和 ID 排序，保证分页稳定
+func lessAlert(a, b Alert, field string) bool {
+	switch field {
+	case "index":
+		if a.Index != b.Index {
+			return a.Index < b.Index
+		}
+	case "cluster":
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+	case "delay":
+		da, _ := connector.ParseDuration(a.Delay)
+		db, _ := connector.ParseDuration(b.Delay)
+		if da != db {
+			return da < db
+		}
+	case "threshold":
+		if a.Threshold != b.Threshold {
+			return lessThreshold(a.Threshold, b.Threshold)
+		}
+	case "id":
+		return lessID(a.ID, b.ID)
+	}
+	nameA, nameB := strings.ToLower(a.Name), strings.ToLower(b.Name)
+	if nameA != nameB {
+		return nameA < nameB
+	}
+	return lessID(a.ID, b.ID)
+}
+
+// lessThreshold 先按运算符、再按数值比较阈值，使 >=5 排在 >=10 之前；
+// 动态基线的宏等无法解析为数值的阈值排在最后
+func lessThreshold(a, b string) bool {
+	opA, valueA := SplitThreshold(a)
+	opB, valueB := SplitThreshold(b)
+	numberA, errA := strconv.ParseFloat(valueA, 64)
+	numberB, errB := strconv.ParseFloat(valueB, 64)
+	if (errA == nil) != (errB == nil) {
+		return errA == nil
+	}
+	if opA != opB {
+		return opA < opB
+	}
+	if errA == nil && numberA != numberB {
+		return numberA < numberB
+	}
+	return a < b
+}
+
+// lessID Zabbix 监控项 ID 为不带前导零的数字，按长度再按文本比较即为数值顺序；
+// 内置引擎的 ID 为长度相同的 MD5，同样按文本排序
+func lessID(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// ListAlerts 筛选、排序并返回指定页的告警和满足条件的总数
+func ListAlerts(config configs.Config, st *store.Store, query ListAlertsParamQuery) ([]Alert, int, error) {
+	alerts, err := LoadAlerts(config, st)
+	if err != nil {
+		return nil, 0, err
+	}
+	matched := make([]Alert, 0, len(alerts))
+	for _, alert := range alerts {
+		if matchAlert(alert, query) {
+			matched = append(matched, alert)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if query.Order == "desc" {
+			return lessAlert(matched[j], matched[i], query.Sort)
+		}
+		return lessAlert(matched[i], matched[j], query.Sort)
+	})
+
+	start := (query.Page - 1) * query.PageSize
+	if start > len(matched) {
+		start = len(matched)
+	}
+	end := start + query.PageSize
+	if end > len(matched) {
+		end = len(matched)
+	}
+	return matched[start:end], len(matched), nil
+}
+
+// ListAlertsV2
+// @Summary List Alerts
+// @Schemes http
+// @Description 列出全部集群和索引的告警，支持按索引前缀、名称、阈值、检查周期、标签、是否启用和是否触发筛选，以及排序和分页
+// @Tags alert-v2
+// @Produce json
+// @Param page query int false "页码，从 1 开始" default(1)
+// @Param page_size query int false "每页数量，最大 500" default(50)
+// @Param sort query string false "排序字段：name、index、cluster、delay、threshold 或 id" default(name)
+// @Param order query string false "asc 或 desc" default(asc)
+// @Param cluster query string false "集群名称，为空时列出全部集群"
+// @Param index_prefix query string false "索引前缀"
+// @Param name query string false "名称包含的文本，不区分大小写"
+// @Param threshold query string false "阈值，如 >=10"
+// @Param delay query string false "检查周期，如 1m"
+// @Param tag query string false "监控项标签，tag 或 tag:value"
+// @Param enabled query bool false "是否启用"
+// @Param firing query bool false "是否处于触发状态"
+// @Success 200 {object} AlertListResponse
+// @Failure 422 {object} ErrorResponse
+// @Security BasicAuth
+// @Router /v2/alerts [get]
+func ListAlertsV2(c *gin.Context) {
+	var query ListAlertsParamQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		abortV2(c, http.StatusUnprocessableEntity, err, nil)
+		return
+	}
+
+	config := c.MustGet("config").(configs.Config)
+	st := c.MustGet("store").(*store.Store)
+	alerts, total, err := ListAlerts(config, st, query)
+	if err != nil {
+		abortV2(c, http.StatusInternalServerError, err, nil)
+		return
+	}
+	c.JSON(http.StatusOK, AlertListResponse{
+		Data:     alerts,
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+	})
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestLessThreshold(t *testing.T) {
+	thresholds := []string{">{$LOGS_BASELINE_B}", ">=10", "<5", ">100", ">=5", ">{$LOGS_BASELINE_A}", ">9.5", "<0.5"}
+	sort.Slice(thresholds, func(i, j int) bool {
+		return lessThreshold(thresholds[i], thresholds[j])
+	})
+	want := []string{"<0.5", "<5", ">9.5", ">100", ">=5", ">=10", ">{$LOGS_BASELINE_A}", ">{$LOGS_BASELINE_B}"}
+	for i := range want {
+		if thresholds[i] != want[i] {
+			t.Fatalf("sorted thresholds = %v, want %v", thresholds, want)
+		}
+	}
+}
@@ -4,20 +4,26 @@ import (
 	"crypto/md5"
 	"crypto/tls"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"gin-zabbix/configs"
 	"gin-zabbix/connector"
 	"gin-zabbix/docs"
+	"gin-zabbix/store"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"net/http"
 	"os"
-	"strings"
+	"regexp"
+	"strconv"
 	"time"
 )
 
-// @BasePath /api/v1
+// @BasePath /api
 // @Title Log Alarm Management Service
 // @version 1.0
 // @license.name Apache 2.0
@@ -32,7 +38,7 @@ import (
 // @Accept json
 // @Produce json
 // @Success 200 {string} Health Check
-// @Router /monitor/health_check [get]
+// @Router /v1/monitor/health_check [get]
 func HealthCheck(c *gin.Context) {
 	config := c.MustGet("config").(configs.Config)
 	tr := &http.Transport{
@@ -42,8 +48,11 @@ func HealthCheck(c *gin.Context) {
 		Timeout:   3 * time.Second,
 		Transport: tr,
 	}
-	// 检查Zabbix服务是否可用
-	_, err := client.Get(config.Zabbix.Url)
+	// 检查Zabbix服务是否可用，内置告警引擎不使用 Zabbix
+	var err error
+	if config.Alerting.Backend != alertingInternal {
+		_, err = client.Get(config.Zabbix.Url)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status": "failure",
@@ -52,8 +61,11 @@ func HealthCheck(c *gin.Context) {
 		})
 		return
 	}
-	// 检查Elasticsearch服务是否可用
-	_, err = client.Get(config.Elasticsearch.Url)
+	// 检查日志后端是否可用
+	backend, err := connector.NewLogBackend(config.Elasticsearch)
+	if err == nil {
+		err = backend.Ping()
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status": "failure",
@@ -62,6 +74,20 @@ func HealthCheck(c *gin.Context) {
 		})
 		return
 	}
+	for name, cluster := range config.Clusters {
+		backend, err := connector.NewLogBackend(cluster)
+		if err == nil {
+			err = backend.Ping()
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status": "failure",
+				"error":  fmt.Sprintf("%s：%s", name, err.Error()),
+				"data":   map[string]interface{}{},
+			})
+			return
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"status": "success",
 		"error":  "",
@@ -70,28 +96,97 @@ func HealthCheck(c *gin.Context) {
 }
 
 type Alert struct {
+	// Zabbix 监控项 ID，内置引擎为 RuleAlertID，/api/v2/alerts/{id} 使用
+	ID            string `json:"id"`
 	Name          string `json:"name"`
 	Key           string `json:"key"`
 	HostID        string `json:"host_id"`
 	HostName      string `json:"host_name"`
 	Elasticsearch string `json:"elasticsearch"`
+	Cluster       string `json:"cluster"`
 	Index         string `json:"index"`
 	QueryString   string `json:"query_string"`
-	Delay         string `json:"delay"`
-	Threshold     string `json:"threshold"`
-	Description   string `json:"description"`
+	// lucene、dsl 或 kql
+	QueryLanguage string `json:"query_language"`
+	// 使用查询 DSL 或 KQL 创建的告警返回 DSL，使用查询 DSL 创建时 query_string 与之相同
+	Query          json.RawMessage `json:"query,omitempty" swaggertype:"object"`
+	Delay          string          `json:"delay"`
+	Window         string          `json:"window"`
+	TimestampField string          `json:"timestamp_field"`
+	Lag            string          `json:"lag"`
+	Threshold      string          `json:"threshold"`
+	Description    string          `json:"description"`
+	// 引用该告警的组合告警名称
+	Composites []string `json:"composites"`
+	// 集群配置了 kibana_url 时返回 Discover 链接
+	DiscoverURL string `json:"discover_url,omitempty"`
+	// 内置告警引擎的执行状态
+	State *RuleState `json:"state,omitempty"`
+	// trapper 模式下最近一次查询和推送的结果
+	Trapper *TrapperStatus `json:"trapper,omitempty"`
+	// 监控项和触发器均已启用，内置引擎的告警总是启用
+	Enabled bool `json:"enabled"`
+	// 触发器处于问题状态，内置引擎为 firing 状态
+	Firing bool            `json:"firing"`
+	Tags   []connector.Tag `json:"tags,omitempty"`
 }
 
 type CreatAlertParamBody struct {
 	Description string `json:"description" binding:"required" example:"description"`
-	Delay       string `json:"delay" binding:"required" example:"3m"`
-	Threshold   string `json:"threshold" binding:"required" example:">=10"`
+	// 检查周期，delay 为兼容旧版本保留的同义字段
+	Interval string `json:"interval" binding:"omitempty,duration" example:"1m"`
+	Delay    string `json:"delay" binding:"omitempty,duration" example:"3m"`
+	// 统计窗口，为空时与检查周期相同
+	Window string `json:"window" binding:"omitempty,duration" example:"15m"`
+	// 入库延迟，统计区间整体向前平移，统计 [now-lag-window, now-lag]
+	Lag       string `json:"lag" binding:"omitempty,duration" example:"1m"`
+	Threshold string `json:"threshold" binding:"required" example:">=10"`
+	// 时间字段，为空时从索引映射中自动识别
+	TimestampField string `json:"timestamp_field" example:"@timestamp"`
+	// 查询 DSL，与 query_string 二选一，服务会自动加上时间范围
+	Query json.RawMessage `json:"query" swaggertype:"object"`
+	// query_string 的语法，kql 时翻译为查询 DSL 保存，默认为 lucene
+	QueryLanguage string `json:"query_language" binding:"omitempty,oneof=lucene kql" example:"kql"`
+	// 创建前使用 _search?profile 执行一次查询并估算每天的查询耗时
+	Profile bool `json:"profile" example:"false"`
+	// 启用动态基线时，threshold 中的数值仅作为基线计算出来之前的初始阈值
+	Baseline *BaselineParam `json:"baseline"`
 }
 
 type CreatAlertParamQuery struct {
 	Name        string `form:"name" binding:"required"`
 	Index       string `form:"index" binding:"required"`
-	QueryString string `form:"query_string" binding:"required"`
+	QueryString string `form:"query_string"`
+	Cluster     string `form:"cluster"`
+}
+
+// ClusterHostName 已索引名称命名主机，非默认集群的主机名加上集群名前缀，避免不同集群的同名索引共用主机
+func ClusterHostName(cluster, index string) string {
+	if cluster == "" || cluster == configs.DefaultCluster {
+		return connector.HostName(index)
+	}
+	return connector.HostName(cluster) + "_" + connector.HostName(index)
+}
+
+func legacyClusterHostName(cluster, index string) string {
+	if cluster == "" || cluster == configs.DefaultCluster {
+		return connector.LegacyHostName(index)
+	}
+	return connector.HostName(cluster) + "_" + connector.LegacyHostName(index)
+}
+
+// GetIndexHost 查找索引对应的主机，没有时查找之前版本命名的主机，都没有时返回空结构体
+func GetIndexHost(zabbix *connector.Zabbix, cluster, index string) (connector.Host, error) {
+	hostName := ClusterHostName(cluster, index)
+	host, err := zabbix.GetHostByName(hostName)
+	if err != nil || host.HostID != "" {
+		return host, err
+	}
+	legacyName := legacyClusterHostName(cluster, index)
+	if legacyName == hostName {
+		return host, nil
+	}
+	return zabbix.GetHostByName(legacyName)
 }
 
 // CreatAlert
@@ -103,11 +198,12 @@ type CreatAlertParamQuery struct {
 // @Produce json
 // @Param name query string true "名称"
 // @Param index query string true "索引"
-// @Param query_string query string true "查询字符串"
+// @Param query_string query string false "查询字符串，与请求体中的 query 二选一"
+// @Param cluster query string false "Elasticsearch 集群名称，默认为 default"
 // @Param request body CreatAlertParamBody true "默认配置"
 // @Success 200 {string} Success
 // @Security BasicAuth
-// @Router /alert/creat [post]
+// @Router /v1/alert/creat [post]
 func CreatAlert(c *gin.Context) {
 
 	var body CreatAlertParamBody
@@ -130,84 +226,348 @@ func CreatAlert(c *gin.Context) {
 	}
 
 	config := c.MustGet("config").(configs.Config)
-	username := config.Elasticsearch.Username
-	password := config.Elasticsearch.Password
-	elasticsearch := config.Elasticsearch.Url
+	st := c.MustGet("store").(*store.Store)
+	data, status, err := CreateAlert(config, st, query, body)
+	if err != nil {
+		if data == nil {
+			data = map[string]interface{}{}
+		}
+		c.JSON(status, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   data,
+		})
+		return
+	}
+
+	c.JSON(status, gin.H{
+		"status": "success",
+		"error":  "",
+		"data":   data,
+	})
+}
+
+// alertPlan 校验通过、待写入 Zabbix 或内置引擎的告警，创建和修改共用
+type alertPlan struct {
+	cluster       configs.ElasticsearchConfig
+	backend       connector.LogBackend
+	key           string
+	delay         string
+	window        string
+	queryLanguage string
+	dsl           json.RawMessage
+	request       connector.LogRequest
+	warnings      []LintIssue
+	cost          *CostEstimate
+	discoverURL   string
+}
+
+// planAlert 校验索引、查询和检查周期并生成日志后端的请求，查询检查拒绝时返回的数据中包含警告
+func planAlert(config configs.Config, query CreatAlertParamQuery, body CreatAlertParamBody) (alertPlan, map[string]interface{}, int, error) {
+	var plan alertPlan
+	cluster, err := config.GetCluster(query.Cluster)
+	if err != nil {
+		return plan, nil, http.StatusUnprocessableEntity, err
+	}
+	backend, err := connector.NewLogBackend(cluster)
+	if err != nil {
+		return plan, nil, http.StatusUnprocessableEntity, err
+	}
+	plan.cluster = cluster
+	plan.backend = backend
+
+	hash := md5.Sum([]byte(query.Name))
+	plan.key = hex.EncodeToString(hash[:])
+	plan.delay = body.Interval
+	if plan.delay == "" {
+		plan.delay = body.Delay
+	}
+	if plan.delay == "" {
+		return plan, nil, http.StatusUnprocessableEntity, errors.New("interval 和 delay 不能同时为空")
+	}
+	// 与请求体的 duration 校验相同，命令行导入不经过请求体绑定
+	for _, duration := range [][2]string{{"interval", plan.delay}, {"window", body.Window}, {"lag", body.Lag}} {
+		if duration[1] != "" && !durationPattern.MatchString(duration[1]) {
+			return plan, nil, http.StatusUnprocessableEntity, fmt.Errorf("%s 不是合法的时间长度：%s", duration[0], duration[1])
+		}
+	}
+	plan.window = body.Window
+	if plan.window == "" {
+		plan.window = plan.delay
+	}
+	index := query.Index
+
+	// 写入 Zabbix 之前先校验索引和查询
+	queryString, dsl, err := TranslateQuery(body.QueryLanguage, query.QueryString, body.Query)
+	if err != nil {
+		return plan, nil, http.StatusUnprocessableEntity, err
+	}
+	plan.dsl = dsl
+	plan.request, err = backend.BuildRequest(index, connector.LogQuery{
+		QueryString:    queryString,
+		Query:          dsl,
+		TimestampField: body.TimestampField,
+		Window:         plan.window,
+		Lag:            body.Lag,
+	})
+	if err != nil {
+		return plan, nil, http.StatusUnprocessableEntity, err
+	}
+	err = backend.Validate(index, plan.request)
+	if err != nil {
+		return plan, nil, http.StatusUnprocessableEntity, err
+	}
+
+	// 检查查询代价，查询语句的检查只适用于 Elasticsearch
+	es, isElasticsearch := backend.(*connector.ElasticsearchBackend)
+	if config.Lint.Policy != lintPolicyOff {
+		if isElasticsearch {
+			plan.warnings = LintQuery(queryString, dsl)
+		}
+		plan.warnings = append(plan.warnings, LintSchedule(plan.delay, plan.window, config.Lint)...)
+		if config.Lint.Policy == lintPolicyDeny && len(plan.warnings) > 0 {
+			return plan, map[string]interface{}{
+				"warnings": plan.warnings,
+			}, http.StatusUnprocessableEntity, errors.New(FormatLintIssues(plan.warnings))
+		}
+	}
+	if body.Profile {
+		if !isElasticsearch {
+			return plan, nil, http.StatusUnprocessableEntity, fmt.Errorf("%s 不支持 profile", backend.Name())
+		}
+		estimate, err := EstimateCost(es.Client(), index, plan.request.Posts, plan.delay)
+		if err != nil {
+			return plan, nil, http.StatusInternalServerError, err
+		}
+		plan.cost = &estimate
+	}
+
+	plan.queryLanguage = queryLanguageLucene
+	if body.QueryLanguage == queryLanguageKQL {
+		plan.queryLanguage = queryLanguageKQL
+	} else if len(dsl) > 0 {
+		plan.queryLanguage = queryLanguageDSL
+	}
+	plan.discoverURL = AlertDiscoverURL(cluster, index, plan.queryLanguage, query.QueryString, dsl, plan.window, body.Lag)
+	return plan, nil, http.StatusOK, nil
+}
+
+// rule 内置引擎保存的告警定义
+func (p alertPlan) rule(query CreatAlertParamQuery, body CreatAlertParamBody) Rule {
+	queryString := query.QueryString
+	if p.queryLanguage == queryLanguageDSL {
+		queryString = string(p.dsl)
+	}
+	return Rule{
+		ID:             RuleID(query.Cluster, query.Index, p.key),
+		Name:           query.Name,
+		Key:            p.key,
+		Cluster:        query.Cluster,
+		Index:          query.Index,
+		QueryString:    queryString,
+		QueryLanguage:  p.queryLanguage,
+		Query:          p.dsl,
+		Delay:          p.delay,
+		Window:         p.window,
+		TimestampField: p.request.TimestampField,
+		Lag:            body.Lag,
+		Threshold:      body.Threshold,
+		Description:    body.Description,
+		DiscoverURL:    p.discoverURL,
+		Request:        p.request,
+	}
+}
+
+// tags 监控项上记录查询语法和日志后端的标签
+// itemDescription 监控项的描述，KQL 告警在描述之后附上原始 KQL
+func (p alertPlan) itemDescription(query CreatAlertParamQuery, body CreatAlertParamBody) string {
+	if p.queryLanguage != queryLanguageKQL {
+		return body.Description
+	}
+	return KQLDescription(body.Description, query.QueryString)
+}
 
+func (p alertPlan) tags() []connector.Tag {
+	var tags []connector.Tag
+	if p.queryLanguage == queryLanguageKQL {
+		tags = append(tags, connector.Tag{Tag: queryLanguageTag, Value: queryLanguageKQL})
+	}
+	if p.backend.Name() != connector.BackendElasticsearch {
+		tags = append(tags, connector.Tag{Tag: connector.BackendTag, Value: p.backend.Name()})
+	}
+	return tags
+}
+
+// CreateAlert 创建告警规则：校验索引和查询、写入监控项和触发器，返回响应数据和 HTTP 状态码，
+// 创建接口和导入接口共用
+func CreateAlert(config configs.Config, st *store.Store, query CreatAlertParamQuery, body CreatAlertParamBody) (map[string]interface{}, int, error) {
+	plan, lintData, status, err := planAlert(config, query, body)
+	if err != nil {
+		return lintData, status, err
+	}
 	name := query.Name
-	hash := md5.Sum([]byte(name))
-	key := hex.EncodeToString(hash[:])
-	delay := body.Delay
+	key := plan.key
+	delay := plan.delay
 	threshold := body.Threshold
-	description := body.Description
+	description := plan.itemDescription(query, body)
 	index := query.Index
-	queryString := query.QueryString
-	posts := connector.GeneratePosts(queryString, delay)
-	url := fmt.Sprintf("%s/%s/_search", elasticsearch, index)
+	request := plan.request
+	warnings := plan.warnings
+	cost := plan.cost
+	discoverURL := plan.discoverURL
 
-	zabbix := connector.NewZabbix(config.Zabbix.Url, config.Zabbix.Token)
+	// 内置引擎只保存告警定义，由 RunRules 执行
+	if config.Alerting.Backend == alertingInternal {
+		if body.Baseline != nil {
+			return nil, http.StatusUnprocessableEntity, errors.New("内置告警引擎不支持动态基线")
+		}
+		_, err = EvaluateThreshold(threshold, 0)
+		if err != nil {
+			return nil, http.StatusUnprocessableEntity, err
+		}
+		rule := plan.rule(query, body)
+		err = AddRule(st, rule)
+		if errors.Is(err, errRuleExists) {
+			return nil, http.StatusConflict, err
+		}
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		return alertData(map[string]interface{}{"id": rule.ID}, warnings, cost, discoverURL), http.StatusOK, nil
+	}
 
-	// 已索引名称命名主机
-	hostName := strings.ReplaceAll(index, "*", "")
-	host, err := zabbix.GetHostByName(hostName)
+	var tags []connector.Tag
+	initialThreshold := ""
+	if body.Baseline != nil {
+		op, value := SplitThreshold(threshold)
+		if op == "" {
+			return nil, http.StatusUnprocessableEntity, errors.New("动态基线的 threshold 必须以比较运算符开头")
+		}
+		percentile := body.Baseline.Percentile
+		if percentile == 0 {
+			percentile = config.Baseline.Percentile
+		}
+		tags = []connector.Tag{
+			{Tag: baselinePercentileTag, Value: strconv.FormatFloat(percentile, 'f', -1, 64)},
+			{Tag: baselineMarginTag, Value: strconv.FormatFloat(body.Baseline.Margin, 'f', -1, 64)},
+		}
+		initialThreshold = value
+		if initialThreshold == "" {
+			initialThreshold = "0"
+		}
+		threshold = op + BaselineMacro(key)
+	}
+	tags = append(tags, plan.tags()...)
+
+	hostName := ClusterHostName(query.Cluster, index)
+	_, err = connector.TriggerExpression(hostName, key, threshold)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"status": "failure",
-			"error":  err.Error(),
-			"data":   map[string]interface{}{},
-		})
-		return
+		return nil, http.StatusUnprocessableEntity, err
+	}
+
+	zabbix := connector.NewZabbix(config.Zabbix.Url, config.Zabbix.Token)
+	host, err := GetIndexHost(zabbix, query.Cluster, index)
+	if err != nil {
+		return nil, http.StatusNotFound, err
 	}
 
 	hostID := ""
 	if host.HostID == "" {
 		createdHostID, err := zabbix.CreateHost(hostName, "22")
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{
-				"status": "failure",
-				"error":  err.Error(),
-				"data":   map[string]interface{}{},
-			})
-			return
+			return nil, http.StatusNotFound, err
 		}
 		hostID = createdHostID
 	} else {
+		// 之前版本命名的主机继续使用
 		hostID = host.HostID
+		hostName = host.Host
 	}
 
-	itemID, err := zabbix.CreateItem(name, key, hostID, delay, username, password, url, posts, description)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status": "failure",
-			"error":  err.Error(),
-			"data":   map[string]interface{}{},
+	var itemID string
+	if config.Zabbix.Mode == zabbixModeTrapper {
+		itemID, err = zabbix.CreateTrapperItem(name, key, hostID, description, tags)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		err = SaveTrapperItem(st, itemID, TrapperItem{
+			Host:    hostName,
+			Key:     key,
+			Cluster: query.Cluster,
+			Index:   index,
+			Delay:   delay,
+			Request: request,
 		})
-		return
+		if err != nil {
+			// 没有保存查询的 trapper 监控项不会被推送，删除以免在 Zabbix 中留下孤立的监控项
+			_, deleteErr := zabbix.DeleteItemByID(itemID)
+			if deleteErr != nil {
+				err = fmt.Errorf("%s；删除监控项 %s 失败：%s", err.Error(), itemID, deleteErr.Error())
+			}
+		}
+	} else {
+		itemID, err = zabbix.CreateItem(name, key, hostID, delay, plan.cluster, request, description, tags)
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
 	}
 
-	TriggerID, err := zabbix.CreateTrigger(hostName, name, key, threshold)
+	// 监控项创建后的步骤失败时，删除监控项及已保存的 KQL 和基线宏，以免留下没有触发器的监控项
+	rollback := func(err error) error {
+		deleteErr := DeleteAlertItem(zabbix, st, connector.Item{ItemID: itemID, HostID: hostID, Key: key})
+		if deleteErr != nil {
+			return fmt.Errorf("%s；删除监控项 %s 失败：%s", err.Error(), itemID, deleteErr.Error())
+		}
+		return err
+	}
+
+	if body.QueryLanguage == queryLanguageKQL {
+		err = SaveKQL(st, itemID, query.QueryString)
+		if err != nil {
+			return nil, http.StatusInternalServerError, rollback(err)
+		}
+	}
+
+	if body.Baseline != nil {
+		err = SetBaselineMacro(zabbix, hostID, key, initialThreshold)
+		if err != nil {
+			return nil, http.StatusInternalServerError, rollback(err)
+		}
+	}
+
+	triggerURL, comments, linkWarnings := triggerLink(discoverURL)
+	warnings = append(warnings, linkWarnings...)
+
+	TriggerID, err := zabbix.CreateTrigger(hostName, name, key, threshold, triggerURL, comments)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status": "failure",
-			"error":  err.Error(),
-			"data":   map[string]interface{}{},
-		})
-		return
+		return nil, http.StatusInternalServerError, rollback(err)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"status": "success",
-		"error":  "",
-		"data": map[string]interface{}{
-			"itemID":    itemID,
-			"TriggerID": TriggerID,
-		},
-	})
+	data := map[string]interface{}{
+		"itemID":    itemID,
+		"TriggerID": TriggerID,
+	}
+	return alertData(data, warnings, cost, discoverURL), http.StatusOK, nil
+}
+
+// alertData 在创建结果中附上查询检查、代价估算和 Discover 链接
+func alertData(data map[string]interface{}, warnings []LintIssue, cost *CostEstimate, discoverURL string) map[string]interface{} {
+	if len(warnings) > 0 {
+		data["warnings"] = warnings
+	}
+	if cost != nil {
+		data["cost"] = cost
+	}
+	if discoverURL != "" {
+		data["discover_url"] = discoverURL
+	}
+	return data
 }
 
 type DeleteAlertParamQuery struct {
-	Name  string `form:"name" binding:"required"`
-	Index string `form:"index" binding:"required"`
+	Name    string `form:"name" binding:"required"`
+	Index   string `form:"index" binding:"required"`
+	Cluster string `form:"cluster"`
 }
 
 // DeleteAlert
@@ -219,9 +579,10 @@ type DeleteAlertParamQuery struct {
 // @Produce json
 // @Param name query string true "名称"
 // @Param index query string true "索引"
+// @Param cluster query string false "Elasticsearch 集群名称，默认为 default"
 // @Success 204 {string} Success
 // @Security BasicAuth
-// @Router /alert/delete [delete]
+// @Router /v1/alert/delete [delete]
 func DeleteAlert(c *gin.Context) {
 	var query DeleteAlertParamQuery
 	if err := c.ShouldBindQuery(&query); err != nil {
@@ -234,13 +595,41 @@ func DeleteAlert(c *gin.Context) {
 	}
 
 	config := c.MustGet("config").(configs.Config)
+	if config.Alerting.Backend == alertingInternal {
+		st := c.MustGet("store").(*store.Store)
+		hash := md5.Sum([]byte(query.Name))
+		deleted, err := DeleteRule(st, RuleID(query.Cluster, query.Index, hex.EncodeToString(hash[:])))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status": "failure",
+				"error":  err.Error(),
+				"data":   map[string]interface{}{},
+			})
+			return
+		}
+		if !deleted {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status": "failure",
+				"error":  fmt.Sprintf("告警不存在：%s", query.Name),
+				"data":   map[string]interface{}{},
+			})
+			return
+		}
+		c.JSON(http.StatusNoContent, gin.H{
+			"status": "success",
+			"error":  "",
+			"data": map[string]interface{}{
+				"itemName": query.Name,
+			},
+		})
+		return
+	}
 	zabbix := connector.NewZabbix(config.Zabbix.Url, config.Zabbix.Token)
 
 	itemName := query.Name
 	index := query.Index
 	// 已索引名称命名主机
-	hostName := strings.ReplaceAll(index, "*", "")
-	host, err := zabbix.GetHostByName(hostName)
+	host, err := GetIndexHost(zabbix, query.Cluster, index)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"status": "failure",
@@ -267,7 +656,8 @@ func DeleteAlert(c *gin.Context) {
 		})
 		return
 	}
-	_, err = zabbix.DeleteItemByID(item.ItemID)
+	st := c.MustGet("store").(*store.Store)
+	err = DeleteAlertItem(zabbix, st, item)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status": "failure",
@@ -286,8 +676,37 @@ func DeleteAlert(c *gin.Context) {
 	})
 }
 
+// DeleteAlertItem 删除监控项及其触发器，清理本地缓存的 KQL、trapper 查询、动态基线历史和主机宏
+func DeleteAlertItem(zabbix *connector.Zabbix, st *store.Store, item connector.Item) error {
+	_, err := zabbix.DeleteItemByID(item.ItemID)
+	if err != nil {
+		return err
+	}
+	err = DeleteKQL(st, item.ItemID)
+	if err != nil {
+		return err
+	}
+	err = DeleteTrapperItem(st, item.ItemID)
+	if err != nil {
+		return err
+	}
+	err = DeleteBaselineHistory(st, item.ItemID)
+	if err != nil {
+		return err
+	}
+	macro, err := zabbix.GetUserMacro(item.HostID, BaselineMacro(item.Key))
+	if err == nil && macro.HostMacroID != "" {
+		_, err = zabbix.DeleteUserMacro(macro.HostMacroID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type QueryAlertParamQuery struct {
-	Index string `form:"index" binding:"required"`
+	Index   string `form:"index" binding:"required"`
+	Cluster string `form:"cluster"`
 }
 
 // QueryAlert
@@ -298,9 +717,10 @@ type QueryAlertParamQuery struct {
 // @Accept json
 // @Produce json
 // @Param index query string true "索引"
+// @Param cluster query string false "Elasticsearch 集群名称，默认为 default"
 // @Success 200 {string} Success
 // @Security BasicAuth
-// @Router /alert/query [get]
+// @Router /v1/alert/query [get]
 func QueryAlert(c *gin.Context) {
 
 	var query QueryAlertParamQuery
@@ -315,11 +735,44 @@ func QueryAlert(c *gin.Context) {
 
 	config := c.MustGet("config").(configs.Config)
 	zabbix := connector.NewZabbix(config.Zabbix.Url, config.Zabbix.Token)
+	_, err := config.GetCluster(query.Cluster)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
 
 	index := query.Index
+	if config.Alerting.Backend == alertingInternal {
+		alerts, err := QueryRules(config, c.MustGet("store").(*store.Store), query.Cluster, index)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status": "failure",
+				"error":  err.Error(),
+				"data":   map[string]interface{}{},
+			})
+			return
+		}
+		if len(alerts) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status": "failure",
+				"error":  "索引没有告警",
+				"data":   map[string]interface{}{},
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"error":  "",
+			"data":   alerts,
+		})
+		return
+	}
 	// 已索引名称命名主机
-	hostName := strings.ReplaceAll(index, "*", "")
-	host, err := zabbix.GetHostByName(hostName)
+	host, err := GetIndexHost(zabbix, query.Cluster, index)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"status": "failure",
@@ -347,22 +800,65 @@ func QueryAlert(c *gin.Context) {
 		return
 	}
 
+	itemIDs := make([]string, 0, len(items))
+	for i := range items {
+		itemIDs = append(itemIDs, items[i].ItemID)
+	}
+	composites := map[string][]string{}
+	if len(itemIDs) > 0 {
+		triggers, err := zabbix.GetCompositeTriggers(itemIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status": "failure",
+				"error":  err.Error(),
+				"data":   map[string]interface{}{},
+			})
+			return
+		}
+		for _, trigger := range triggers {
+			for _, item := range trigger.Items {
+				composites[item.ItemID] = append(composites[item.ItemID], trigger.Description)
+			}
+		}
+	}
+
+	st := c.MustGet("store").(*store.Store)
+	kqlQueries, err := LoadKQL(st)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	trapperItems, err := LoadTrapperItems(st)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	trapperStatus, err := LoadTrapperStatus(st)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
 	var alerts []Alert
 	for i := range items {
-		trigger, _ := zabbix.GetTriggerByName(items[i].Name)
-		index := items[i].GetIndex()
-		hostName := strings.ReplaceAll(index, "*", "")
-		alert := Alert{
-			Name:          items[i].Name,
-			Key:           items[i].Key,
-			HostID:        items[i].HostID,
-			HostName:      hostName,
-			Elasticsearch: items[i].GetElasticsearch(),
-			Index:         index,
-			QueryString:   items[i].GetQueryString(),
-			Delay:         items[i].Delay,
-			Description:   items[i].Description,
-			Threshold:     trigger.GetThreshold(),
+		FillTrapperItem(&items[i], trapperItems)
+		alert := ItemAlert(config, query.Cluster, items[i], kqlQueries[items[i].ItemID])
+		alert.Composites = composites[items[i].ItemID]
+		if status, ok := trapperStatus[items[i].ItemID]; ok {
+			alert.Trapper = &status
 		}
 		alerts = append(alerts, alert)
 	}
@@ -374,9 +870,72 @@ func QueryAlert(c *gin.Context) {
 	})
 }
 
+// ItemAlert 从监控项及其告警触发器还原告警，cluster 为告警所在的集群，
+// kql 为本地缓存的原始 KQL，监控项描述中保存了 KQL 时以描述为准
+func ItemAlert(config configs.Config, cluster string, item connector.Item, kql string) Alert {
+	clusterConfig, _ := config.GetCluster(cluster)
+	index := item.GetIndex()
+	queryString := item.GetQueryString()
+	queryLanguage := queryLanguageLucene
+	var dsl json.RawMessage
+	if item.IsDSL() {
+		dsl = item.GetQuery()
+		queryLanguage = queryLanguageDSL
+	}
+	description, itemKQL := SplitKQLDescription(item.Description)
+	if itemKQL != "" {
+		kql = itemKQL
+	}
+	if kql != "" {
+		queryString = kql
+		queryLanguage = queryLanguageKQL
+	}
+	trigger, ok := item.AlertTrigger()
+	enabled := ok && item.Status == "0" && trigger.Status == "0"
+	return Alert{
+		ID:             item.ItemID,
+		Name:           item.Name,
+		Key:            item.Key,
+		HostID:         item.HostID,
+		HostName:       ClusterHostName(cluster, index),
+		Elasticsearch:  item.GetElasticsearch(),
+		Cluster:        config.ClusterName(item.GetElasticsearch()),
+		Index:          index,
+		QueryString:    queryString,
+		QueryLanguage:  queryLanguage,
+		Delay:          item.Delay,
+		Window:         item.GetWindow(),
+		TimestampField: item.GetTimestampField(),
+		Lag:            item.GetLag(),
+		Description:    description,
+		Threshold:      trigger.GetThreshold(),
+		Query:          dsl,
+		DiscoverURL:    ItemDiscoverURL(clusterConfig, item, kql),
+		Composites:     []string{},
+		Enabled:        enabled,
+		Firing:         enabled && trigger.Value == "1",
+		Tags:           item.Tags,
+	}
+}
+
+// durationPattern Zabbix 与 Elasticsearch 日期运算共同支持的时间长度写法
+var durationPattern = regexp.MustCompile(`^[1-9][0-9]*[smhdw]$`)
+
+func validateDuration(fl validator.FieldLevel) bool {
+	return durationPattern.MatchString(fl.Field().String())
+}
+
 func main() {
 	r := gin.Default()
 
+	// 注册自定义参数校验
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		err := v.RegisterValidation("duration", validateDuration)
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	// 加载配置文件，获取配置对象
 	dir, err := os.Getwd()
 	if err != nil {
@@ -387,19 +946,57 @@ func main() {
 		panic(err)
 	}
 
+	st, err := store.NewStore(config.Storage.Path)
+	if err != nil {
+		panic(err)
+	}
+
+	// export 子命令只导出告警，不启动服务
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		err = RunExportCommand(config, st, os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	// import-elastalert 子命令只导入规则，不启动服务
+	if len(os.Args) > 1 && os.Args[1] == "import-elastalert" {
+		err = RunImportElastAlertCommand(config, st, os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 将配置对象存储在 Gin 上下文中
 	r.Use(func(c *gin.Context) {
 		c.Set("config", config)
+		c.Set("store", st)
 		c.Next()
 	})
 
+	if config.Alerting.Backend == alertingInternal {
+		go RunRules(config, st)
+	} else {
+		// 周期计算动态基线阈值
+		go RunBaseline(config, st)
+		if config.Zabbix.Mode == zabbixModeTrapper {
+			go RunTrapper(config, st)
+		}
+		if config.Enrichment.Enabled {
+			go RunEnrichment(config, st)
+		}
+	}
+
 	// Basic Authentication middleware
 	authorized := r.Group("/api/v1", gin.BasicAuth(gin.Accounts{
 		config.BasicAuth.Username: config.BasicAuth.Password,
 	}))
 
 	// 路由和处理程序
-	docs.SwaggerInfo.BasePath = "/api/v1"
+	docs.SwaggerInfo.BasePath = "/api"
 	v1 := authorized
 	{
 		ag := v1.Group("/alert")
@@ -407,6 +1004,45 @@ func main() {
 			ag.POST("/creat", CreatAlert)
 			ag.GET("/query", QueryAlert)
 			ag.DELETE("/delete", DeleteAlert)
+			ag.GET("/baseline", requireZabbix, QueryBaseline)
+			ag.POST("/preview", PreviewAlert)
+			ag.POST("/backtest", BacktestAlert)
+			ag.GET("/enrichment", requireZabbix, QueryEnrichment)
+			ag.POST("/import", ImportAlert)
+			ag.POST("/import/elastalert", ImportElastAlert)
+			ag.GET("/export", ExportAlert)
+			ag.POST("/export/watcher", InstallWatch)
+		}
+	}
+	{
+		cg := v1.Group("/composite", requireZabbix)
+		{
+			cg.POST("/creat", CreatCompositeAlert)
+			cg.GET("/query", QueryCompositeAlert)
+			cg.DELETE("/delete", DeleteCompositeAlert)
+		}
+	}
+	{
+		dg := v1.Group("/discovery")
+		{
+			dg.GET("/indices", DiscoverIndices)
+			dg.GET("/fields", DiscoverFields)
+		}
+	}
+
+	// v2 以 ID 标识告警，参数全部在 JSON 请求体中
+	v2 := r.Group("/api/v2", gin.BasicAuth(gin.Accounts{
+		config.BasicAuth.Username: config.BasicAuth.Password,
+	}))
+	{
+		ag := v2.Group("/alerts")
+		{
+			ag.GET("", ListAlertsV2)
+			ag.POST("", CreateAlertV2)
+			ag.GET("/:id", GetAlertV2)
+			ag.PUT("/:id", ReplaceAlertV2)
+			ag.PATCH("/:id", PatchAlertV2)
+			ag.DELETE("/:id", DeleteAlertV2)
 		}
 	}
 	r.GET("/api/v1/monitor/health_check", HealthCheck)
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gin-zabbix/configs"
+	"gin-zabbix/connector"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type PreviewAlertParamBody struct {
+	Interval  string   `json:"interval" binding:"omitempty,duration" example:"1m"`
+	Delay     string   `json:"delay" binding:"omitempty,duration" example:"3m"`
+	Window    string   `json:"window" binding:"omitempty,duration" example:"15m"`
+	Lag       string   `json:"lag" binding:"omitempty,duration" example:"1m"`
+	Threshold string   `json:"threshold" example:">=10"`
+	Size      int      `json:"size" binding:"omitempty,min=1,max=100" example:"10"`
+	Fields    []string `json:"fields" example:"@timestamp,message"`
+	// 查询 DSL，与 query_string 二选一
+	Query json.RawMessage `json:"query" swaggertype:"object"`
+	// 时间字段，为空时从索引映射中自动识别
+	TimestampField string `json:"timestamp_field" example:"@timestamp"`
+	// query_string 的语法，默认为 lucene
+	QueryLanguage string `json:"query_language" binding:"omitempty,oneof=lucene kql" example:"kql"`
+}
+
+// EvaluateThreshold 按 Zabbix 触发器的比较语义判断 value 是否满足阈值表达式
+func EvaluateThreshold(threshold string, value float64) (bool, error) {
+	op, number := SplitThreshold(threshold)
+	limit, err := strconv.ParseFloat(number, 64)
+	if op == "" || err != nil {
+		return false, fmt.Errorf("无法解析阈值：%s", threshold)
+	}
+	switch op {
+	case ">=":
+		return value >= limit, nil
+	case "<=":
+		return value <= limit, nil
+	case "<>":
+		return value != limit, nil
+	case ">":
+		return value > limit, nil
+	case "<":
+		return value < limit, nil
+	default:
+		return value == limit, nil
+	}
+}
+
+// triggerCount 触发器表达式 last(...,#3) 中的 #3
+const triggerCount = 3
+
+// EvaluateTrigger 按 CreateTrigger 生成的 last(...,#3)<threshold> 判断是否触发：values 为按时间顺序的各次检查结果，
+// 与 Zabbix 相同，只比较倒数第 3 个值，值不足 3 个时不触发
+func EvaluateTrigger(threshold string, values []float64) (bool, error) {
+	if len(values) < triggerCount {
+		_, err := EvaluateThreshold(threshold, 0)
+		return false, err
+	}
+	return EvaluateThreshold(threshold, values[len(values)-triggerCount])
+}
+
+// PreviewAlert
+// @Summary Preview Alert
+// @Schemes http
+// @Description 预览告警规则：立即执行查询，返回当前命中数、是否超过阈值以及示例文档
+// @Tags alert
+// @Accept json
+// @Produce json
+// @Param name query string true "名称"
+// @Param index query string true "索引"
+// @Param query_string query string false "查询字符串，与请求体中的 query 二选一"
+// @Param cluster query string false "Elasticsearch 集群名称，默认为 default"
+// @Param request body PreviewAlertParamBody true "预览配置"
+// @Success 200 {string} Success
+// @Security BasicAuth
+// @Router /v1/alert/preview [post]
+func PreviewAlert(c *gin.Context) {
+	var body PreviewAlertParamBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	var query CreatAlertParamQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	config := c.MustGet("config").(configs.Config)
+
+	delay := body.Interval
+	if delay == "" {
+		delay = body.Delay
+	}
+	window := body.Window
+	if window == "" {
+		window = delay
+	}
+	if window == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  "interval、delay 和 window 不能同时为空",
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	size := body.Size
+	if size == 0 {
+		size = 10
+	}
+
+	cluster, err := config.GetCluster(query.Cluster)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	backend, err := connector.NewLogBackend(cluster)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	queryString, dsl, err := TranslateQuery(body.QueryLanguage, query.QueryString, body.Query)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+	request, err := backend.BuildRequest(query.Index, connector.LogQuery{
+		QueryString:    queryString,
+		Query:          dsl,
+		TimestampField: body.TimestampField,
+		Window:         window,
+		Lag:            body.Lag,
+	})
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	result, err := backend.Preview(query.Index, request, connector.PreviewOptions{
+		Size:   size,
+		Fields: body.Fields,
+	})
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "failure",
+			"error":  err.Error(),
+			"data":   map[string]interface{}{},
+		})
+		return
+	}
+
+	data := map[string]interface{}{
+		"name":  query.Name,
+		"count": result.Total,
+		"hits":  result.Hits,
+	}
+	if body.Threshold != "" {
+		breached, err := EvaluateThreshold(body.Threshold, float64(result.Total))
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"status": "failure",
+				"error":  err.Error(),
+				"data":   map[string]interface{}{},
+			})
+			return
+		}
+		data["threshold"] = body.Threshold
+		data["breached"] = breached
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"error":  "",
+		"data":   data,
+	})
+}
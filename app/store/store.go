@@ -0,0 +1,93 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store 以 JSON 文件的形式保存服务自身的状态，每个 name 对应目录下的一个文件
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewStore(dir string) (*Store, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("创建数据目录失败：%s", err.Error())
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
+
+// Load 读取 name 对应的数据到 v，文件不存在时保持 v 不变
+func (s *Store) Load(name string, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(name, v)
+}
+
+// Save 先写临时文件再重命名，避免进程中断时留下半个文件
+func (s *Store) Save(name string, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(name, v)
+}
+
+// Update 在同一次加锁中读取数据到 v、调用 update 修改 v 并保存，
+// 避免并发的 Load 和 Save 互相覆盖；update 返回错误时不保存
+func (s *Store) Update(name string, v interface{}, update func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.load(name, v)
+	if err != nil {
+		return err
+	}
+	err = update()
+	if err != nil {
+		return err
+	}
+	return s.save(name, v)
+}
+
+func (s *Store) load(name string, v interface{}) error {
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取数据失败：%s", err.Error())
+	}
+
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("解析数据失败：%s", err.Error())
+	}
+	return nil
+}
+
+func (s *Store) save(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("JSON编码失败：%s", err.Error())
+	}
+
+	tmp := s.path(name) + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return fmt.Errorf("写入数据失败：%s", err.Error())
+	}
+	err = os.Rename(tmp, s.path(name))
+	if err != nil {
+		return fmt.Errorf("写入数据失败：%s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"gin-zabbix/configs"
+	"gin-zabbix/connector"
+	"gin-zabbix/store"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// trapper 模式：Zabbix 只保存 trapper 监控项和触发器，本服务按检查周期执行查询，
+// 通过 sender 协议把命中数推送到 Zabbix server 或 proxy，Zabbix 不需要访问日志后端。
+
+const (
+	zabbixModeTrapper      = "trapper"
+	trapperStoreName       = "trapper"
+	trapperStatusStoreName = "trapper_status"
+)
+
+// TrapperItem trapper 监控项的查询，创建时由日志后端生成，与 HTTP agent 监控项的请求相同
+type TrapperItem struct {
+	Host    string               `json:"host"`
+	Key     string               `json:"key"`
+	Cluster string               `json:"cluster"`
+	Index   string               `json:"index"`
+	Delay   string               `json:"delay"`
+	Request connector.LogRequest `json:"request"`
+}
+
+// TrapperStatus 监控项最近一次查询和推送的结果
+type TrapperStatus struct {
+	LastRun time.Time `json:"last_run"`
+	Value   int64     `json:"value"`
+	// 查询失败或推送失败的原因
+	Error string `json:"error,omitempty"`
+}
+
+// SaveTrapperItem 保存监控项对应的查询
+func SaveTrapperItem(st *store.Store, itemID string, item TrapperItem) error {
+	items := map[string]TrapperItem{}
+	return st.Update(trapperStoreName, &items, func() error {
+		items[itemID] = item
+		return nil
+	})
+}
+
+// DeleteTrapperItem 删除监控项对应的查询，不存在时不做任何操作
+func DeleteTrapperItem(st *store.Store, itemID string) error {
+	items := map[string]TrapperItem{}
+	return st.Update(trapperStoreName, &items, func() error {
+		delete(items, itemID)
+		return nil
+	})
+}
+
+// LoadTrapperItems 返回所有监控项 ID 到查询的映射
+func LoadTrapperItems(st *store.Store) (map[string]TrapperItem, error) {
+	items := map[string]TrapperItem{}
+	err := st.Load(trapperStoreName, &items)
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func LoadTrapperStatus(st *store.Store) (map[string]TrapperStatus, error) {
+	statuses := map[string]TrapperStatus{}
+	err := st.Load(trapperStatusStoreName, &statuses)
+	if err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// FillTrapperItem 用保存的查询补全 trapper 监控项的检查周期、URL、请求体和查询参数，
+// 之后可以与 HTTP agent 监控项一样解析索引、查询语句和统计窗口
+func FillTrapperItem(item *connector.Item, trapperItems map[string]TrapperItem) {
+	trapperItem, ok := trapperItems[item.ItemID]
+	if !ok {
+		return
+	}
+	item.Delay = trapperItem.Delay
+	item.Url = trapperItem.Request.Url
+	item.Posts = trapperItem.Request.Posts
+	item.QueryFields = trapperItem.Request.QueryFields
+}
+
+// queryTrapperItem 执行监控项的查询，返回命中数
+func queryTrapperItem(config configs.Config, item TrapperItem) (int64, error) {
+	cluster, err := config.GetCluster(item.Cluster)
+	if err != nil {
+		return 0, err
+	}
+	backend, err := connector.NewLogBackend(cluster)
+	if err != nil {
+		return 0, err
+	}
+	result, err := backend.Preview(item.Index, item.Request, connector.PreviewOptions{})
+	if err != nil {
+		return 0, err
+	}
+	return result.Total, nil
+}
+
+// setTrapperPushResult 记录推送结果，result 为只包含该监控项的值时的结果或整批成功时的结果
+func setTrapperPushResult(statuses map[string]TrapperStatus, id string, result connector.SenderResult, err error) {
+	status := statuses[id]
+	if err != nil {
+		status.Error = fmt.Sprintf("推送失败：%s", err.Error())
+	} else if result.Failed > 0 {
+		status.Error = fmt.Sprintf("值未被 Zabbix 接受，请检查主机和监控项是否存在：%s", result.Info)
+	}
+	statuses[id] = status
+}
+
+// pushTrapperValues 执行到期的监控项，按 batch_size 分批推送，结果记录到每个监控项的状态
+func pushTrapperValues(config configs.Config, st *store.Store) {
+	items, err := LoadTrapperItems(st)
+	if err != nil {
+		log.Printf("读取 trapper 监控项失败：%s", err.Error())
+		return
+	}
+	statuses, err := LoadTrapperStatus(st)
+	if err != nil {
+		log.Printf("读取 trapper 状态失败：%s", err.Error())
+		return
+	}
+
+	ids := make([]string, 0, len(items))
+	for id := range items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	now := time.Now()
+	var values []connector.SenderValue
+	var valueIDs []string
+	for _, id := range ids {
+		item := items[id]
+		status := statuses[id]
+		interval, err := connector.ParseDuration(item.Delay)
+		if err != nil {
+			status.Error = fmt.Sprintf("无法解析检查周期：%s", item.Delay)
+			statuses[id] = status
+			continue
+		}
+		if !status.LastRun.IsZero() && now.Sub(status.LastRun) < interval {
+			continue
+		}
+
+		status.LastRun = now
+		value, err := queryTrapperItem(config, item)
+		if err != nil {
+			log.Printf("执行监控项 %s/%s 失败：%s", item.Host, item.Key, err.Error())
+			status.Error = err.Error()
+			statuses[id] = status
+			continue
+		}
+		status.Value = value
+		status.Error = ""
+		statuses[id] = status
+		values = append(values, connector.SenderValue{
+			Host:  item.Host,
+			Key:   item.Key,
+			Value: strconv.FormatInt(value, 10),
+			Clock: now.Unix(),
+			NS:    now.Nanosecond(),
+		})
+		valueIDs = append(valueIDs, id)
+	}
+
+	sender := connector.NewZabbixSender(config.Zabbix.Trapper.Address)
+	batchSize := config.Zabbix.Trapper.BatchSize
+	for start := 0; start < len(values); start += batchSize {
+		end := start + batchSize
+		if end > len(values) {
+			end = len(values)
+		}
+		result, err := sender.Send(values[start:end])
+		if err == nil && result.Failed > 0 {
+			// Zabbix 不返回具体是哪个值未被接受，逐个重新推送该批的值，记录每个监控项自身的结果
+			log.Printf("Zabbix 未接受部分监控项的值，逐个重新推送：%s", result.Info)
+			for i, value := range values[start:end] {
+				result, err := sender.Send([]connector.SenderValue{value})
+				setTrapperPushResult(statuses, valueIDs[start+i], result, err)
+			}
+			continue
+		}
+		if err != nil {
+			log.Printf("推送监控项的值失败：%s", err.Error())
+		}
+		for _, id := range valueIDs[start:end] {
+			setTrapperPushResult(statuses, id, result, err)
+		}
+	}
+
+	// 清理已删除监控项的状态
+	for id := range statuses {
+		if _, ok := items[id]; !ok {
+			delete(statuses, id)
+		}
+	}
+	err = st.Save(trapperStatusStoreName, statuses)
+	if err != nil {
+		log.Printf("保存 trapper 状态失败：%s", err.Error())
+	}
+}
+
+// RunTrapper trapper 模式下按配置的周期检查到期的监控项
+func RunTrapper(config configs.Config, st *store.Store) {
+	interval, err := time.ParseDuration(config.Zabbix.Trapper.Interval)
+	if err != nil {
+		log.Printf("trapper 检查周期配置错误：%s", err.Error())
+		return
+	}
+	pushTrapperValues(config, st)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		pushTrapperValues(config, st)
+	}
+}
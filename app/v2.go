@@ -0,0 +1,546 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin-zabbix/configs"
+	"gin-zabbix/connector"
+	"gin-zabbix/store"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// /api/v2/alerts：以 ID 标识告警的资源接口，参数全部放在 JSON 请求体中，
+// 创建和修改与 v1 走同一流程，v1 接口保持不变
+
+// AlertSpec 告警定义，创建、替换和部分修改使用同一结构，name、cluster 和 index 创建后不能修改
+type AlertSpec struct {
+	Name    string `json:"name" binding:"required" example:"error logs"`
+	Cluster string `json:"cluster" example:"default"`
+	Index   string `json:"index" binding:"required" example:"logs-*"`
+	// lucene、kql 或 dsl，为空时提供 query 即为 dsl，否则为 lucene
+	QueryLanguage string `json:"query_language" binding:"omitempty,oneof=lucene kql dsl" example:"kql"`
+	// lucene 或 kql 查询语句
+	QueryString string `json:"query_string" example:"level:error"`
+	// 查询 DSL，query_language 为 dsl 时使用
+	Query json.RawMessage `json:"query,omitempty" swaggertype:"object"`
+	// 检查周期
+	Interval string `json:"interval" binding:"required,duration" example:"1m"`
+	// 统计窗口，为空时与检查周期相同
+	Window         string `json:"window" binding:"omitempty,duration" example:"15m"`
+	Lag            string `json:"lag" binding:"omitempty,duration" example:"1m"`
+	Threshold      string `json:"threshold" binding:"required" example:">=10"`
+	TimestampField string `json:"timestamp_field" example:"@timestamp"`
+	Description    string `json:"description" example:"description"`
+	// 只在创建时使用，修改已有告警时不能指定
+	Baseline *BaselineParam `json:"baseline,omitempty"`
+	Profile  bool           `json:"profile,omitempty" example:"false"`
+}
+
+// AlertResponse 单个告警的响应
+type AlertResponse struct {
+	Data Alert `json:"data"`
+	// 创建或修改时的查询检查警告
+	Warnings []LintIssue `json:"warnings,omitempty"`
+	// profile 为 true 时的查询代价估算
+	Cost *CostEstimate `json:"cost,omitempty"`
+}
+
+// ErrorResponse 失败时的响应，HTTP 状态码表示错误类型
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Message string `json:"message"`
+	// 附加信息，如查询检查拒绝时的警告
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+func abortV2(c *gin.Context, status int, err error, details map[string]interface{}) {
+	c.AbortWithStatusJSON(status, ErrorResponse{
+		Error: ErrorDetail{Message: err.Error(), Details: details},
+	})
+}
+
+// params 转换为 v1 的查询参数和请求体
+func (s AlertSpec) params() (CreatAlertParamQuery, CreatAlertParamBody, error) {
+	query := CreatAlertParamQuery{
+		Name:        s.Name,
+		Index:       s.Index,
+		QueryString: s.QueryString,
+		Cluster:     s.Cluster,
+	}
+	body := CreatAlertParamBody{
+		Description:    s.Description,
+		Interval:       s.Interval,
+		Window:         s.Window,
+		Lag:            s.Lag,
+		Threshold:      s.Threshold,
+		TimestampField: s.TimestampField,
+		Profile:        s.Profile,
+		Baseline:       s.Baseline,
+	}
+	language := s.QueryLanguage
+	if language == "" && len(s.Query) > 0 {
+		language = queryLanguageDSL
+	}
+	switch language {
+	case queryLanguageDSL:
+		if len(s.Query) == 0 || s.QueryString != "" {
+			return query, body, errors.New("query_language 为 dsl 时必须提供 query，且不能提供 query_string")
+		}
+		body.Query = s.Query
+	case queryLanguageKQL:
+		if len(s.Query) > 0 {
+			return query, body, errors.New("query 只能在 query_language 为 dsl 时使用")
+		}
+		body.QueryLanguage = queryLanguageKQL
+	default:
+		if len(s.Query) > 0 {
+			return query, body, errors.New("query 只能在 query_language 为 dsl 时使用")
+		}
+	}
+	return query, body, nil
+}
+
+// alertSpec 已有告警的定义，部分修改时在此基础上合并请求体
+func alertSpec(alert Alert) AlertSpec {
+	spec := AlertSpec{
+		Name:           alert.Name,
+		Cluster:        alert.Cluster,
+		Index:          alert.Index,
+		QueryLanguage:  alert.QueryLanguage,
+		QueryString:    alert.QueryString,
+		Interval:       alert.Delay,
+		Window:         alert.Window,
+		Lag:            alert.Lag,
+		Threshold:      alert.Threshold,
+		TimestampField: alert.TimestampField,
+		Description:    alert.Description,
+	}
+	if alert.QueryLanguage == queryLanguageDSL {
+		spec.QueryString = ""
+		spec.Query = alert.Query
+	}
+	return spec
+}
+
+// sameAlert name、cluster 和 index 决定监控项所在的主机和 key，与已有告警一致时才能修改
+func sameAlert(spec AlertSpec, alert Alert) bool {
+	cluster := spec.Cluster
+	if cluster == "" {
+		cluster = configs.DefaultCluster
+	}
+	return spec.Name == alert.Name && spec.Index == alert.Index && cluster == alert.Cluster
+}
+
+// GetAlert 按 ID 获取告警，不存在时返回 404
+func GetAlert(config configs.Config, st *store.Store, id string) (Alert, int, error) {
+	if config.Alerting.Backend == alertingInternal {
+		rule, ok, err := FindRule(st, id)
+		if err != nil {
+			return Alert{}, http.StatusInternalServerError, err
+		}
+		if !ok {
+			return Alert{}, http.StatusNotFound, fmt.Errorf("告警不存在：%s", id)
+		}
+		states, err := LoadRuleStates(st)
+		if err != nil {
+			return Alert{}, http.StatusInternalServerError, err
+		}
+		var state *RuleState
+		if s, ok := states[rule.ID]; ok {
+			state = &s
+		}
+		return RuleAlert(config, rule, state), http.StatusOK, nil
+	}
+
+	// Zabbix 监控项 ID 为数字，其他值直接视为不存在
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return Alert{}, http.StatusNotFound, fmt.Errorf("告警不存在：%s", id)
+	}
+	zabbix := connector.NewZabbix(config.Zabbix.Url, config.Zabbix.Token)
+	item, err := zabbix.GetItemByID(id)
+	if err != nil {
+		return Alert{}, http.StatusInternalServerError, err
+	}
+	if item.ItemID == "" {
+		return Alert{}, http.StatusNotFound, fmt.Errorf("告警不存在：%s", id)
+	}
+	trapperItems, err := LoadTrapperItems(st)
+	if err != nil {
+		return Alert{}, http.StatusInternalServerError, err
+	}
+	FillTrapperItem(&item, trapperItems)
+	kqlQueries, err := LoadKQL(st)
+	if err != nil {
+		return Alert{}, http.StatusInternalServerError, err
+	}
+	alert := ItemAlert(config, config.ClusterName(item.GetElasticsearch()), item, kqlQueries[id])
+
+	triggers, err := zabbix.GetCompositeTriggers([]string{id})
+	if err != nil {
+		return Alert{}, http.StatusInternalServerError, err
+	}
+	alert.Composites = []string{}
+	for _, trigger := range triggers {
+		alert.Composites = append(alert.Composites, trigger.Description)
+	}
+	statuses, err := LoadTrapperStatus(st)
+	if err != nil {
+		return Alert{}, http.StatusInternalServerError, err
+	}
+	if status, ok := statuses[id]; ok {
+		alert.Trapper = &status
+	}
+	return alert, http.StatusOK, nil
+}
+
+// alertExists 创建前检查同一主机下是否已有同名告警，Zabbix 的重复 key 错误无法与其他错误区分
+func alertExists(config configs.Config, query CreatAlertParamQuery) (bool, error) {
+	if config.Alerting.Backend == alertingInternal {
+		// 内置引擎由 AddRule 判断
+		return false, nil
+	}
+	zabbix := connector.NewZabbix(config.Zabbix.Url, config.Zabbix.Token)
+	host, err := GetIndexHost(zabbix, query.Cluster, query.Index)
+	if err != nil {
+		return false, err
+	}
+	if host.HostID == "" {
+		return false, nil
+	}
+	items, err := zabbix.GetItemsByHost(host.HostID)
+	if err != nil {
+		return false, err
+	}
+	for _, item := range items {
+		if item.Name == query.Name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// UpdateAlert 按新的定义修改告警，监控项 ID 和触发器保持不变，动态基线告警不能修改
+func UpdateAlert(config configs.Config, st *store.Store, id string, spec AlertSpec) (map[string]interface{}, int, error) {
+	current, status, err := GetAlert(config, st, id)
+	if err != nil {
+		return nil, status, err
+	}
+	if !sameAlert(spec, current) {
+		return nil, http.StatusUnprocessableEntity, errors.New("name、cluster 和 index 不能修改，请删除后重新创建")
+	}
+	if spec.Baseline != nil || strings.Contains(current.Threshold, "{$") {
+		return nil, http.StatusUnprocessableEntity, errors.New("动态基线告警不能修改，请删除后重新创建")
+	}
+	query, body, err := spec.params()
+	if err != nil {
+		return nil, http.StatusUnprocessableEntity, err
+	}
+	plan, lintData, status, err := planAlert(config, query, body)
+	if err != nil {
+		return lintData, status, err
+	}
+	data := alertData(map[string]interface{}{}, plan.warnings, plan.cost, plan.discoverURL)
+
+	if config.Alerting.Backend == alertingInternal {
+		_, err = EvaluateThreshold(body.Threshold, 0)
+		if err != nil {
+			return nil, http.StatusUnprocessableEntity, err
+		}
+		updated, err := UpdateRule(st, plan.rule(query, body))
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		if !updated {
+			return nil, http.StatusNotFound, fmt.Errorf("告警不存在：%s", id)
+		}
+		return data, http.StatusOK, nil
+	}
+
+	zabbix := connector.NewZabbix(config.Zabbix.Url, config.Zabbix.Token)
+	host, err := GetIndexHost(zabbix, query.Cluster, query.Index)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	hostName := host.Host
+	_, err = connector.TriggerExpression(hostName, plan.key, body.Threshold)
+	if err != nil {
+		return nil, http.StatusUnprocessableEntity, err
+	}
+	trigger, err := zabbix.GetAlertTrigger(id)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	trapperItems, err := LoadTrapperItems(st)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if _, ok := trapperItems[id]; ok {
+		err = zabbix.UpdateTrapperItem(id, plan.itemDescription(query, body), plan.tags())
+		if err == nil {
+			err = SaveTrapperItem(st, id, TrapperItem{
+				Host:    hostName,
+				Key:     plan.key,
+				Cluster: query.Cluster,
+				Index:   query.Index,
+				Delay:   plan.delay,
+				Request: plan.request,
+			})
+		}
+	} else {
+		err = zabbix.UpdateItem(id, plan.delay, plan.cluster, plan.request, plan.itemDescription(query, body), plan.tags())
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if plan.queryLanguage == queryLanguageKQL {
+		err = SaveKQL(st, id, query.QueryString)
+	} else {
+		err = DeleteKQL(st, id)
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	triggerURL, comments, linkWarnings := triggerLink(plan.discoverURL)
+	if len(linkWarnings) > 0 {
+		data["warnings"] = append(plan.warnings, linkWarnings...)
+	}
+	err = zabbix.UpdateTrigger(trigger.TriggerID, hostName, plan.key, body.Threshold, triggerURL, comments)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return data, http.StatusOK, nil
+}
+
+// alertResponse 读取修改后的告警，并附上查询检查和代价估算
+func alertResponse(config configs.Config, st *store.Store, id string, data map[string]interface{}) (AlertResponse, int, error) {
+	alert, status, err := GetAlert(config, st, id)
+	if err != nil {
+		return AlertResponse{}, status, err
+	}
+	response := AlertResponse{Data: alert}
+	if warnings, ok := data["warnings"].([]LintIssue); ok {
+		response.Warnings = warnings
+	}
+	if cost, ok := data["cost"].(*CostEstimate); ok {
+		response.Cost = cost
+	}
+	return response, http.StatusOK, nil
+}
+
+// CreateAlertV2
+// @Summary Create Alert
+// @Schemes http
+// @Description 创建告警，成功时返回 201 和告警，Location 为告警地址；同名告警已存在时返回 409
+// @Tags alert-v2
+// @Accept json
+// @Produce json
+// @Param request body AlertSpec true "告警定义"
+// @Success 201 {object} AlertResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Security BasicAuth
+// @Router /v2/alerts [post]
+func CreateAlertV2(c *gin.Context) {
+	var spec AlertSpec
+	if err := c.ShouldBindJSON(&spec); err != nil {
+		abortV2(c, http.StatusUnprocessableEntity, err, nil)
+		return
+	}
+	query, body, err := spec.params()
+	if err != nil {
+		abortV2(c, http.StatusUnprocessableEntity, err, nil)
+		return
+	}
+
+	config := c.MustGet("config").(configs.Config)
+	st := c.MustGet("store").(*store.Store)
+	exists, err := alertExists(config, query)
+	if err != nil {
+		abortV2(c, http.StatusInternalServerError, err, nil)
+		return
+	}
+	if exists {
+		abortV2(c, http.StatusConflict, errRuleExists, nil)
+		return
+	}
+	data, status, err := CreateAlert(config, st, query, body)
+	if err != nil {
+		abortV2(c, status, err, data)
+		return
+	}
+
+	var id string
+	if config.Alerting.Backend == alertingInternal {
+		id = RuleAlertID(data["id"].(string))
+	} else {
+		id = data["itemID"].(string)
+	}
+	response, status, err := alertResponse(config, st, id, data)
+	if err != nil {
+		abortV2(c, status, err, nil)
+		return
+	}
+	c.Header("Location", c.Request.URL.Path+"/"+id)
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetAlertV2
+// @Summary Get Alert
+// @Schemes http
+// @Description 按 ID 获取告警
+// @Tags alert-v2
+// @Produce json
+// @Param id path string true "告警 ID"
+// @Success 200 {object} AlertResponse
+// @Failure 404 {object} ErrorResponse
+// @Security BasicAuth
+// @Router /v2/alerts/{id} [get]
+func GetAlertV2(c *gin.Context) {
+	config := c.MustGet("config").(configs.Config)
+	st := c.MustGet("store").(*store.Store)
+	alert, status, err := GetAlert(config, st, c.Param("id"))
+	if err != nil {
+		abortV2(c, status, err, nil)
+		return
+	}
+	c.JSON(http.StatusOK, AlertResponse{Data: alert})
+}
+
+// ReplaceAlertV2
+// @Summary Replace Alert
+// @Schemes http
+// @Description 用完整的定义替换告警，name、cluster 和 index 必须与原告警一致，动态基线告警不能修改
+// @Tags alert-v2
+// @Accept json
+// @Produce json
+// @Param id path string true "告警 ID"
+// @Param request body AlertSpec true "告警定义"
+// @Success 200 {object} AlertResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Security BasicAuth
+// @Router /v2/alerts/{id} [put]
+func ReplaceAlertV2(c *gin.Context) {
+	var spec AlertSpec
+	if err := c.ShouldBindJSON(&spec); err != nil {
+		abortV2(c, http.StatusUnprocessableEntity, err, nil)
+		return
+	}
+	updateAlertV2(c, spec)
+}
+
+// PatchAlertV2
+// @Summary Patch Alert
+// @Schemes http
+// @Description 修改告警的部分字段，未提供的字段保持不变；只提供 query 时查询语法改为 dsl，dsl 告警只提供 query_string 时改为 lucene
+// @Tags alert-v2
+// @Accept json
+// @Produce json
+// @Param id path string true "告警 ID"
+// @Param request body AlertSpec true "要修改的字段"
+// @Success 200 {object} AlertResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Security BasicAuth
+// @Router /v2/alerts/{id} [patch]
+func PatchAlertV2(c *gin.Context) {
+	raw, err := c.GetRawData()
+	if err != nil {
+		abortV2(c, http.StatusBadRequest, err, nil)
+		return
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		abortV2(c, http.StatusUnprocessableEntity, err, nil)
+		return
+	}
+
+	config := c.MustGet("config").(configs.Config)
+	st := c.MustGet("store").(*store.Store)
+	current, status, err := GetAlert(config, st, c.Param("id"))
+	if err != nil {
+		abortV2(c, status, err, nil)
+		return
+	}
+	spec := alertSpec(current)
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		abortV2(c, http.StatusUnprocessableEntity, err, nil)
+		return
+	}
+	if _, ok := fields["query_language"]; !ok {
+		if _, ok := fields["query"]; ok {
+			spec.QueryLanguage = queryLanguageDSL
+			spec.QueryString = ""
+		} else if _, ok := fields["query_string"]; ok && spec.QueryLanguage == queryLanguageDSL {
+			spec.QueryLanguage = queryLanguageLucene
+			spec.Query = nil
+		}
+	}
+	if err := binding.Validator.ValidateStruct(&spec); err != nil {
+		abortV2(c, http.StatusUnprocessableEntity, err, nil)
+		return
+	}
+	updateAlertV2(c, spec)
+}
+
+func updateAlertV2(c *gin.Context, spec AlertSpec) {
+	config := c.MustGet("config").(configs.Config)
+	st := c.MustGet("store").(*store.Store)
+	id := c.Param("id")
+	data, status, err := UpdateAlert(config, st, id, spec)
+	if err != nil {
+		abortV2(c, status, err, data)
+		return
+	}
+	response, status, err := alertResponse(config, st, id, data)
+	if err != nil {
+		abortV2(c, status, err, nil)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteAlertV2
+// @Summary Delete Alert
+// @Schemes http
+// @Description 按 ID 删除告警，成功时返回 204
+// @Tags alert-v2
+// @Produce json
+// @Param id path string true "告警 ID"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Security BasicAuth
+// @Router /v2/alerts/{id} [delete]
+func DeleteAlertV2(c *gin.Context) {
+	config := c.MustGet("config").(configs.Config)
+	st := c.MustGet("store").(*store.Store)
+	id := c.Param("id")
+	alert, status, err := GetAlert(config, st, id)
+	if err != nil {
+		abortV2(c, status, err, nil)
+		return
+	}
+
+	if config.Alerting.Backend == alertingInternal {
+		_, err = DeleteRule(st, RuleID(alert.Cluster, alert.Index, alert.Key))
+	} else {
+		zabbix := connector.NewZabbix(config.Zabbix.Url, config.Zabbix.Token)
+		err = DeleteAlertItem(zabbix, st, connector.Item{ItemID: id, HostID: alert.HostID, Key: alert.Key})
+	}
+	if err != nil {
+		abortV2(c, http.StatusInternalServerError, err, nil)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}